@@ -0,0 +1,123 @@
+package maigo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	pjson "github.com/TikhonP/maigo/internal/json"
+)
+
+var (
+	ErrInvalidActionSignature = errors.New("maigo: invalid action signature")
+	ErrActionExpired          = errors.New("maigo: action link expired")
+)
+
+// ActionContext describes who an action link was issued to. It is returned by ActionSigner.Verify.
+type ActionContext struct {
+	ContractId int
+	Role       UserRole
+	Expires    time.Time
+}
+
+// ActionSigner signs action links with HMAC so agent pages can check that link was issued
+// by agent for the page, contract and role. Signature covers link path, contract id, role and
+// expiry, so link signed for one page cannot be used to open other pages.
+type ActionSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewActionSigner creates ActionSigner with secret of at least 32 bytes.
+// Links of messages without WithActionDeadline expire after ttl, 24h if not set.
+func NewActionSigner(secret []byte, ttl time.Duration) (*ActionSigner, error) {
+	if len(secret) < 32 {
+		return nil, &ConfigError{Problems: []ConfigProblem{{Field: "secret", Reason: "must be at least 32 bytes long"}}}
+	}
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &ActionSigner{secret: append([]byte(nil), secret...), ttl: ttl}, nil
+}
+
+// Sign returns link with "contract_id", "role", "expires" and "signature" query parameters.
+func (s *ActionSigner) Sign(link string, contractId int, role UserRole, expires time.Time) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	if role != Patient && role != Doctor {
+		return "", fmt.Errorf("maigo: unknown role %q", role)
+	}
+	query := u.Query()
+	query.Set("contract_id", strconv.Itoa(contractId))
+	query.Set("role", string(role))
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.signature(u.Path, contractId, role, expires.Unix()))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Verify checks signature of action link u, e.g. URL of the request opening the page.
+// Path of u must be the path of the signed link as it is seen by the agent, so links must
+// not be verified behind handlers rewriting paths, e.g. http.StripPrefix.
+// It returns ErrInvalidActionSignature or ErrActionExpired if link cannot be used.
+func (s *ActionSigner) Verify(u *url.URL) (*ActionContext, error) {
+	query := u.Query()
+	contractId, err := strconv.Atoi(query.Get("contract_id"))
+	if err != nil {
+		return nil, ErrInvalidActionSignature
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidActionSignature
+	}
+	role := UserRole(query.Get("role"))
+	expected := s.signature(u.Path, contractId, role, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return nil, ErrInvalidActionSignature
+	}
+	action := &ActionContext{ContractId: contractId, Role: role, Expires: time.Unix(expires, 0)}
+	if !time.Now().Before(action.Expires) {
+		return nil, ErrActionExpired
+	}
+	return action, nil
+}
+
+func (s *ActionSigner) signature(path string, contractId int, role UserRole, expires int64) string {
+	if path == "" {
+		path = "/"
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	_, _ = fmt.Fprintf(mac, "%s\n%d\n%s\n%d", path, contractId, role, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signedAction holds parameters of WithSignedAction until contract id is known.
+type signedAction struct {
+	signer *ActionSigner
+	role   UserRole
+}
+
+// signAction signs action link of o for contractId. Link expires at action deadline;
+// if deadline is not set, it is set to signer ttl from now so button is hidden when link expires.
+func (o *sendMessageOptions) signAction(contractId int) error {
+	if o.signedAction == nil {
+		return nil
+	}
+	if o.ActionDeadline == nil {
+		deadline := pjson.Timestamp{Time: time.Now().Add(o.signedAction.signer.ttl).Truncate(time.Second)}
+		o.ActionDeadline = &deadline
+	}
+	link, err := o.signedAction.signer.Sign(o.ActionLink, contractId, o.signedAction.role, o.ActionDeadline.Time)
+	if err != nil {
+		return &ValidationError{Field: "action", Reason: err.Error()}
+	}
+	o.ActionLink = link
+	return nil
+}
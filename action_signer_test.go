@@ -0,0 +1,125 @@
+package maigo
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestActionSigner(t *testing.T, ttl time.Duration) *ActionSigner {
+	t.Helper()
+	signer, err := NewActionSigner([]byte("0123456789abcdef0123456789abcdef"), ttl)
+	if err != nil {
+		t.Fatalf("NewActionSigner() error = %v", err)
+	}
+	return signer
+}
+
+func signTestLink(t *testing.T, signer *ActionSigner, link string, expires time.Time) *url.URL {
+	t.Helper()
+	signed, err := signer.Sign(link, 7, Doctor, expires)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	return u
+}
+
+func TestActionSignerVerifiesSignedLink(t *testing.T) {
+	signer := newTestActionSigner(t, 0)
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	u := signTestLink(t, signer, "https://agent.example/form?step=1", expires)
+	action, err := signer.Verify(u)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if action.ContractId != 7 || action.Role != Doctor || !action.Expires.Equal(expires) {
+		t.Fatalf("Verify() = %+v", action)
+	}
+	if u.Query().Get("step") != "1" {
+		t.Fatalf("Sign() dropped link query: %s", u)
+	}
+}
+
+func TestActionSignerRejectsTamperedLink(t *testing.T) {
+	signer := newTestActionSigner(t, 0)
+	expires := time.Now().Add(time.Hour)
+	tests := []struct {
+		name   string
+		tamper func(u *url.URL, query url.Values)
+	}{
+		{"contract id", func(_ *url.URL, q url.Values) { q.Set("contract_id", "8") }},
+		{"role", func(_ *url.URL, q url.Values) { q.Set("role", string(Patient)) }},
+		{"expiry", func(_ *url.URL, q url.Values) { q.Set("expires", strconv.FormatInt(expires.Add(time.Hour).Unix(), 10)) }},
+		{"signature", func(_ *url.URL, q url.Values) { q.Set("signature", "AAAA") }},
+		{"missing signature", func(_ *url.URL, q url.Values) { q.Del("signature") }},
+		{"path", func(u *url.URL, _ url.Values) { u.Path = "/admin" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := signTestLink(t, signer, "https://agent.example/form", expires)
+			query := u.Query()
+			tt.tamper(u, query)
+			u.RawQuery = query.Encode()
+			if _, err := signer.Verify(u); !errors.Is(err, ErrInvalidActionSignature) {
+				t.Fatalf("Verify() error = %v, want ErrInvalidActionSignature", err)
+			}
+		})
+	}
+	other, err := NewActionSigner([]byte("fedcba9876543210fedcba9876543210"), 0)
+	if err != nil {
+		t.Fatalf("NewActionSigner() error = %v", err)
+	}
+	if _, err := other.Verify(signTestLink(t, signer, "https://agent.example/form", expires)); !errors.Is(err, ErrInvalidActionSignature) {
+		t.Fatalf("Verify() with other secret error = %v, want ErrInvalidActionSignature", err)
+	}
+}
+
+func TestActionSignerRejectsExpiredLink(t *testing.T) {
+	signer := newTestActionSigner(t, 0)
+	u := signTestLink(t, signer, "https://agent.example/form", time.Now().Add(-time.Second))
+	if _, err := signer.Verify(u); !errors.Is(err, ErrActionExpired) {
+		t.Fatalf("Verify() error = %v, want ErrActionExpired", err)
+	}
+}
+
+func TestSignActionExpiresAtActionDeadline(t *testing.T) {
+	signer := newTestActionSigner(t, time.Hour)
+	deadline := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	tests := []struct {
+		name string
+		opts []SendMessageOption
+		want time.Time
+	}{
+		{"deadline", []SendMessageOption{WithSignedAction(signer, Patient, "Form", "https://agent.example/form", Action), WithActionDeadline(deadline)}, deadline},
+		{"deadline set first", []SendMessageOption{WithActionDeadline(deadline), WithSignedAction(signer, Patient, "Form", "https://agent.example/form", Action)}, deadline},
+		{"signer ttl", []SendMessageOption{WithSignedAction(signer, Patient, "Form", "https://agent.example/form", Action)}, time.Now().Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newSendMessageOptions("text", tt.opts...)
+			if err := o.signAction(7); err != nil {
+				t.Fatalf("signAction() error = %v", err)
+			}
+			u, err := url.Parse(o.ActionLink)
+			if err != nil {
+				t.Fatalf("url.Parse() error = %v", err)
+			}
+			action, err := signer.Verify(u)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if !action.Expires.Equal(o.ActionDeadline.Time) {
+				t.Fatalf("link expires at %v, action deadline is %v", action.Expires, o.ActionDeadline.Time)
+			}
+			if d := action.Expires.Sub(tt.want); d < -time.Second || d > time.Second {
+				t.Fatalf("link expires at %v, want %v", action.Expires, tt.want)
+			}
+		})
+	}
+}
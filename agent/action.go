@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/TikhonP/maigo"
+)
+
+type actionContextKey struct{}
+
+// ActionFromContext returns ActionContext put into ctx by RequireSignedAction.
+func ActionFromContext(ctx context.Context) (*maigo.ActionContext, bool) {
+	action, ok := ctx.Value(actionContextKey{}).(*maigo.ActionContext)
+	return action, ok
+}
+
+// RequireSignedAction returns http.Handler which verifies action link signed with signer
+// and passes request to next with ActionContext in its context, see ActionFromContext.
+// Requests with invalid signature or path other than the signed one are answered with 403,
+// expired ones with 410.
+func RequireSignedAction(signer *maigo.ActionSigner, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action, err := signer.Verify(r.URL)
+		if err != nil {
+			status := http.StatusForbidden
+			if errors.Is(err, maigo.ErrActionExpired) {
+				status = http.StatusGone
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actionContextKey{}, action)))
+	})
+}
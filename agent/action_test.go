@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TikhonP/maigo"
+)
+
+func TestRequireSignedAction(t *testing.T) {
+	signer, err := maigo.NewActionSigner([]byte("0123456789abcdef0123456789abcdef"), 0)
+	if err != nil {
+		t.Fatalf("NewActionSigner() error = %v", err)
+	}
+	var got *maigo.ActionContext
+	h := RequireSignedAction(signer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ActionFromContext(r.Context())
+	}))
+	sign := func(link string, expires time.Time) string {
+		signed, err := signer.Sign(link, 7, maigo.Patient, expires)
+		if err != nil {
+			t.Fatalf("Sign() error = %v", err)
+		}
+		return signed
+	}
+	valid := sign("https://agent.example/form", time.Now().Add(time.Hour))
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{"unsigned", "https://agent.example/form?contract_id=7", http.StatusForbidden},
+		{"signed for other page", strings.Replace(sign("https://agent.example/other", time.Now().Add(time.Hour)), "/other", "/form", 1), http.StatusForbidden},
+		{"expired", sign("https://agent.example/form", time.Now().Add(-time.Second)), http.StatusGone},
+		{"valid", valid, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			w := serve(h, http.MethodGet, tt.target, "")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if (got != nil) != (tt.want == http.StatusOK) {
+				t.Fatalf("handler got action %+v", got)
+			}
+		})
+	}
+	if got == nil || got.ContractId != 7 || got.Role != maigo.Patient {
+		t.Fatalf("ActionFromContext() = %+v", got)
+	}
+}
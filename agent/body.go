@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// readBody reads request body of at most maxSize bytes.
+func readBody(w http.ResponseWriter, r *http.Request, maxSize int64) ([]byte, error) {
+	if maxSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	}
+	return io.ReadAll(r.Body)
+}
+
+// writeResponse writes "ok" if response is nil and JSON encoded response otherwise.
+func writeResponse(w http.ResponseWriter, response any) {
+	if response == nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, "ok")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
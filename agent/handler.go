@@ -0,0 +1,189 @@
+// Package agent implements server side of Medsenger agent: http.Handler
+// serving callbacks that Medsenger sends to agent.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/TikhonP/maigo"
+)
+
+// Handler serves Medsenger callbacks and dispatches them to configured handlers.
+// Callbacks without configured handler are answered with 404.
+//
+//	http.Handle("/", agent.NewHandler(client, agent.WithContractHandler(contracts)))
+type Handler struct {
+	client  *maigo.Client
+	options handlerOptions
+	mux     *http.ServeMux
+}
+
+// NewHandler creates Handler verifying callbacks with api key of client.
+func NewHandler(client *maigo.Client, opts ...Option) *Handler {
+	h := &Handler{client: client, options: handlerOptions{maxBodySize: 1 << 20}, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt.apply(&h.options)
+	}
+	if contracts := h.options.contracts; contracts != nil {
+		h.mux.HandleFunc("/init", handleJSON(h, func(ctx context.Context, request InitRequest) (any, error) {
+			return nil, contracts.Init(ctx, request)
+		}))
+		h.mux.HandleFunc("/remove", handleJSON(h, func(ctx context.Context, request RemoveRequest) (any, error) {
+			return nil, contracts.Remove(ctx, request)
+		}))
+	}
+	if status := h.options.status; status != nil {
+		h.mux.HandleFunc("/status", handleJSON(h, func(ctx context.Context, _ struct{}) (any, error) {
+			s, err := status.Status(ctx)
+			if err != nil || s == nil {
+				return Status{SupportedScenarios: []string{}, TrackedContracts: []int{}}, err
+			}
+			if s.SupportedScenarios == nil {
+				s.SupportedScenarios = []string{}
+			}
+			if s.TrackedContracts == nil {
+				s.TrackedContracts = []int{}
+			}
+			return s, nil
+		}))
+	}
+	if messages := h.options.messages; messages != nil {
+		h.mux.HandleFunc("/message", handleJSON(h, func(ctx context.Context, request MessageRequest) (any, error) {
+			request.client = client
+			return nil, messages.Message(ctx, request)
+		}))
+	}
+	if hooks := h.options.hooks; hooks != nil {
+		h.mux.HandleFunc("/hook", handleJSON(h, func(ctx context.Context, request HookRequest) (any, error) {
+			return nil, hooks.Hook(ctx, request)
+		}))
+	}
+	if orders := h.options.orders; orders != nil {
+		h.mux.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
+			h.serveOrder(w, r, orders)
+		})
+	}
+	if settings := h.options.settings; settings != nil {
+		h.mux.HandleFunc("/settings", func(w http.ResponseWriter, r *http.Request) {
+			h.serveSettings(w, r, settings)
+		})
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// errInvalidAPIKey is reported when callback carries api key other than Client one.
+var errInvalidAPIKey = errors.New("agent: invalid api_key")
+
+// fail reports err and writes error response.
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h.options.onError != nil {
+		h.options.onError(r, err)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// decode reads JSON callback body into request and verifies its api key.
+// It writes error response and returns false on failure.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, request any) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.fail(w, r, http.StatusMethodNotAllowed, fmt.Errorf("agent: %s %s: method not allowed", r.Method, r.URL.Path))
+		return false
+	}
+	body, err := readBody(w, r, h.options.maxBodySize)
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, fmt.Errorf("agent: %s: %w", r.URL.Path, err))
+		return false
+	}
+	var key struct {
+		ApiKey string `json:"api_key"`
+	}
+	if err := json.Unmarshal(body, &key); err != nil {
+		h.fail(w, r, http.StatusBadRequest, fmt.Errorf("agent: %s: %w", r.URL.Path, err))
+		return false
+	}
+	if !h.client.VerifyAPIKey(r.Context(), key.ApiKey) {
+		h.fail(w, r, http.StatusUnauthorized, fmt.Errorf("%w for %s", errInvalidAPIKey, r.URL.Path))
+		return false
+	}
+	if err := json.Unmarshal(body, request); err != nil {
+		h.fail(w, r, http.StatusBadRequest, fmt.Errorf("agent: %s: %w", r.URL.Path, err))
+		return false
+	}
+	return true
+}
+
+// handleJSON returns http.HandlerFunc decoding callback to Request and passing it to serve.
+// Nil response is written as "ok", other responses are encoded as JSON.
+func handleJSON[Request any](h *Handler, serve func(ctx context.Context, request Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request Request
+		if !h.decode(w, r, &request) {
+			return
+		}
+		response, err := serve(r.Context(), request)
+		if err != nil {
+			h.fail(w, r, http.StatusInternalServerError, fmt.Errorf("agent: %s: %w", r.URL.Path, err))
+			return
+		}
+		writeResponse(w, response)
+	}
+}
+
+// serveOrder passes order to orders and writes OrderResponse. Errors are reported
+// in OrderResponse with status code 404 for unknown orders, 422 for invalid params and 500 otherwise;
+// messages of other errors are not exposed.
+func (h *Handler) serveOrder(w http.ResponseWriter, r *http.Request, orders OrderHandler) {
+	var request OrderRequest
+	if !h.decode(w, r, &request) {
+		return
+	}
+	result, err := orders.Order(r.Context(), request)
+	status, response := http.StatusOK, OrderResponse{State: "ok", Result: result}
+	if err != nil {
+		if h.options.onError != nil {
+			h.options.onError(r, fmt.Errorf("agent: %s: %w", r.URL.Path, err))
+		}
+		message := err.Error()
+		switch {
+		case errors.Is(err, ErrUnknownOrder):
+			status = http.StatusNotFound
+		case errors.Is(err, ErrInvalidOrderParams):
+			status = http.StatusUnprocessableEntity
+		default:
+			status = http.StatusInternalServerError
+			message = http.StatusText(status)
+		}
+		response = OrderResponse{State: "error", Error: message}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) serveSettings(w http.ResponseWriter, r *http.Request, settings SettingsHandler) {
+	query := r.URL.Query()
+	if !h.client.VerifyAPIKey(r.Context(), query.Get("api_key")) {
+		h.fail(w, r, http.StatusUnauthorized, fmt.Errorf("%w for %s", errInvalidAPIKey, r.URL.Path))
+		return
+	}
+	contractId, err := strconv.Atoi(query.Get("contract_id"))
+	if err != nil {
+		h.fail(w, r, http.StatusBadRequest, fmt.Errorf("agent: %s: invalid contract_id: %w", r.URL.Path, err))
+		return
+	}
+	settings.ServeSettings(w, r, SettingsRequest{
+		ContractId: contractId,
+		AgentToken: query.Get("agent_token"),
+		Source:     query.Get("source"),
+	})
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+)
+
+// ContractHandler is notified when agent is connected to or disconnected from contract.
+type ContractHandler interface {
+	Init(ctx context.Context, request InitRequest) error
+	Remove(ctx context.Context, request RemoveRequest) error
+}
+
+// StatusHandler reports contracts tracked by agent.
+type StatusHandler interface {
+	Status(ctx context.Context) (*Status, error)
+}
+
+// SettingsHandler serves agent settings page. Request api key is already verified.
+type SettingsHandler interface {
+	ServeSettings(w http.ResponseWriter, r *http.Request, request SettingsRequest)
+}
+
+// MessageHandler is notified about messages in contract chat.
+// Use MessageRequest.Reply to answer in the same chat.
+type MessageHandler interface {
+	Message(ctx context.Context, request MessageRequest) error
+}
+
+// HookHandler is notified about records of categories agent subscribed to. See RecordRouter.
+type HookHandler interface {
+	Hook(ctx context.Context, request HookRequest) error
+}
+
+// OrderHandler handles orders sent by other agents and returns result for OrderResponse.
+// See OrderRouter.
+type OrderHandler interface {
+	Order(ctx context.Context, request OrderRequest) (any, error)
+}
+
+// ErrorHandler is called with errors returned by handlers and malformed requests.
+type ErrorHandler func(r *http.Request, err error)
+
+type handlerOptions struct {
+	contracts   ContractHandler
+	status      StatusHandler
+	settings    SettingsHandler
+	messages    MessageHandler
+	hooks       HookHandler
+	orders      OrderHandler
+	onError     ErrorHandler
+	maxBodySize int64
+}
+
+type Option interface {
+	apply(*handlerOptions)
+}
+
+// funcOption wraps a function that modifies handlerOptions into an
+// implementation of the Option interface.
+type funcOption struct {
+	f func(*handlerOptions)
+}
+
+func (fo *funcOption) apply(do *handlerOptions) {
+	fo.f(do)
+}
+
+func newFuncOption(f func(*handlerOptions)) *funcOption {
+	return &funcOption{
+		f: f,
+	}
+}
+
+// WithContractHandler returns an Option which serves /init and /remove callbacks with h.
+func WithContractHandler(h ContractHandler) Option {
+	return newFuncOption(func(o *handlerOptions) {
+		o.contracts = h
+	})
+}
+
+// WithStatusHandler returns an Option which serves /status callback with h.
+func WithStatusHandler(h StatusHandler) Option {
+	return newFuncOption(func(o *handlerOptions) {
+		o.status = h
+	})
+}
+
+// WithSettingsHandler returns an Option which serves /settings page with h.
+func WithSettingsHandler(h SettingsHandler) Option {
+	return newFuncOption(func(o *handlerOptions) {
+		o.settings = h
+	})
+}
+
+// WithMessageHandler returns an Option which serves /message callback with h.
+func WithMessageHandler(h MessageHandler) Option {
+	return newFuncOption(func(o *handlerOptions) {
+		o.messages = h
+	})
+}
+
+// WithHookHandler returns an Option which serves /hook callback with h.
+func WithHookHandler(h HookHandler) Option {
+	return newFuncOption(func(o *handlerOptions) {
+		o.hooks = h
+	})
+}
+
+// WithOrderHandler returns an Option which serves /order callback with h.
+func WithOrderHandler(h OrderHandler) Option {
+	return newFuncOption(func(o *handlerOptions) {
+		o.orders = h
+	})
+}
+
+// WithErrorHandler returns an Option which reports errors to h, e.g. for logging.
+func WithErrorHandler(h ErrorHandler) Option {
+	return newFuncOption(func(o *handlerOptions) {
+		o.onError = h
+	})
+}
+
+// WithMaxBodySize returns an Option which limits size of callback body, 1 MiB by default.
+func WithMaxBodySize(n int64) Option {
+	return newFuncOption(func(o *handlerOptions) {
+		o.maxBodySize = n
+	})
+}
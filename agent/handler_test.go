@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TikhonP/maigo"
+)
+
+const testAPIKey = "0123456789abcdef"
+
+type contractsFunc func(request InitRequest) error
+
+func (f contractsFunc) Init(_ context.Context, request InitRequest) error {
+	return f(request)
+}
+
+func (f contractsFunc) Remove(context.Context, RemoveRequest) error {
+	return f(InitRequest{})
+}
+
+type statusFunc func() (*Status, error)
+
+func (f statusFunc) Status(context.Context) (*Status, error) {
+	return f()
+}
+
+type settingsFunc func(request SettingsRequest)
+
+func (f settingsFunc) ServeSettings(w http.ResponseWriter, _ *http.Request, request SettingsRequest) {
+	f(request)
+	_, _ = w.Write([]byte("settings"))
+}
+
+func newTestHandler(t *testing.T, opts ...Option) *Handler {
+	t.Helper()
+	client, err := maigo.NewClient(testAPIKey)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return NewHandler(client, opts...)
+}
+
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestHandlerVerifiesAPIKey(t *testing.T) {
+	called := false
+	h := newTestHandler(t, WithContractHandler(contractsFunc(func(InitRequest) error {
+		called = true
+		return nil
+	})))
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"init with wrong key", "/init", `{"api_key":"wrong","contract_id":1}`},
+		{"init without key", "/init", `{"contract_id":1}`},
+		{"remove with wrong key", "/remove", `{"api_key":"wrong","contract_id":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(h, http.MethodPost, tt.path, tt.body); w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", w.Code)
+			}
+			if called {
+				t.Fatal("handler was called")
+			}
+		})
+	}
+	w := serve(h, http.MethodPost, "/init", `{"api_key":"`+testAPIKey+`","contract_id":1}`)
+	if w.Code != http.StatusOK || w.Body.String() != "ok" || !called {
+		t.Fatalf("status = %d, body = %q, called = %v, want 200 ok", w.Code, w.Body.String(), called)
+	}
+}
+
+func TestHandlerRejectsNotPostRequests(t *testing.T) {
+	h := newTestHandler(t, WithContractHandler(contractsFunc(func(InitRequest) error {
+		t.Error("handler was called")
+		return nil
+	})))
+	w := serve(h, http.MethodGet, "/init", "")
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Fatalf("status = %d, Allow = %q, want 405 with Allow: POST", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestHandlerRejectsOversizedBody(t *testing.T) {
+	h := newTestHandler(t, WithMaxBodySize(64), WithContractHandler(contractsFunc(func(InitRequest) error {
+		t.Error("handler was called")
+		return nil
+	})))
+	body := `{"api_key":"` + testAPIKey + `","contract_id":1,"params":{"note":"` + strings.Repeat("x", 128) + `"}}`
+	if w := serve(h, http.MethodPost, "/init", body); w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestHandlerAnswersUnconfiguredCallbacksWithNotFound(t *testing.T) {
+	h := newTestHandler(t)
+	for _, path := range []string{"/init", "/status", "/message", "/hook", "/order", "/settings"} {
+		if w := serve(h, http.MethodPost, path, `{"api_key":"`+testAPIKey+`"}`); w.Code != http.StatusNotFound {
+			t.Errorf("%s status = %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestHandlerStatusEncodesEmptyLists(t *testing.T) {
+	tests := []struct {
+		name   string
+		status *Status
+	}{
+		{"nil status", nil},
+		{"nil slices", &Status{IsTrackingData: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, WithStatusHandler(statusFunc(func() (*Status, error) {
+				return tt.status, nil
+			})))
+			w := serve(h, http.MethodPost, "/status", `{"api_key":"`+testAPIKey+`"}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response %q: %v", w.Body.String(), err)
+			}
+			if string(body["supported_scenarios"]) != "[]" || string(body["tracked_contracts"]) != "[]" {
+				t.Fatalf("response = %s, want empty lists", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerSettingsVerifiesAPIKey(t *testing.T) {
+	var got *SettingsRequest
+	h := newTestHandler(t, WithSettingsHandler(settingsFunc(func(request SettingsRequest) {
+		got = &request
+	})))
+	if w := serve(h, http.MethodGet, "/settings?contract_id=1&api_key=wrong", ""); w.Code != http.StatusUnauthorized || got != nil {
+		t.Fatalf("status = %d, want 401 without calling handler", w.Code)
+	}
+	if w := serve(h, http.MethodGet, "/settings?contract_id=1", ""); w.Code != http.StatusUnauthorized || got != nil {
+		t.Fatalf("status without key = %d, want 401 without calling handler", w.Code)
+	}
+	if w := serve(h, http.MethodGet, "/settings?contract_id=x&api_key="+testAPIKey, ""); w.Code != http.StatusBadRequest || got != nil {
+		t.Fatalf("status with invalid contract_id = %d, want 400 without calling handler", w.Code)
+	}
+	w := serve(h, http.MethodGet, "/settings?contract_id=7&source=doctor&api_key="+testAPIKey, "")
+	if w.Code != http.StatusOK || got == nil || got.ContractId != 7 || got.Source != "doctor" {
+		t.Fatalf("status = %d, request = %+v, want 200 with contract 7", w.Code, got)
+	}
+}
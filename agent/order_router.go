@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnknownOrder       = errors.New("agent: unknown order")
+	ErrInvalidOrderParams = errors.New("agent: invalid order params")
+)
+
+// OrderRouter is OrderHandler routing orders to handlers registered with HandleOrder.
+// Handlers must be registered before OrderRouter is used.
+//
+//	router := agent.NewOrderRouter()
+//	agent.HandleOrder(router, "change_dose", func(ctx context.Context, request agent.OrderRequest, params ChangeDose) (any, error) {
+//		return nil, updateDose(ctx, request.ContractId, params)
+//	})
+type OrderRouter struct {
+	handlers map[string]func(ctx context.Context, request OrderRequest) (any, error)
+}
+
+func NewOrderRouter() *OrderRouter {
+	return &OrderRouter{handlers: make(map[string]func(ctx context.Context, request OrderRequest) (any, error))}
+}
+
+// HandleOrder registers handler of order with name. Order params are decoded to Params
+// before handler is called; missing params leave Params zero.
+func HandleOrder[Params any](router *OrderRouter, name string, handler func(ctx context.Context, request OrderRequest, params Params) (any, error)) {
+	router.handlers[name] = func(ctx context.Context, request OrderRequest) (any, error) {
+		var params Params
+		if len(request.Params) > 0 && string(request.Params) != "null" {
+			if err := json.Unmarshal(request.Params, &params); err != nil {
+				return nil, fmt.Errorf("%w of %q: %v", ErrInvalidOrderParams, name, err)
+			}
+		}
+		return handler(ctx, request, params)
+	}
+}
+
+// Order passes request to handler registered for its order name.
+// It returns ErrUnknownOrder if there is no such handler.
+func (r *OrderRouter) Order(ctx context.Context, request OrderRequest) (any, error) {
+	handler, ok := r.handlers[request.Order]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownOrder, request.Order)
+	}
+	return handler(ctx, request)
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/TikhonP/maigo"
+)
+
+// RecordHandler handles records of one category added to contract.
+type RecordHandler interface {
+	HandleRecords(ctx context.Context, contractId int, records []maigo.MedicalRecord) error
+}
+
+// RecordHandlerFunc is an adapter to allow the use of ordinary functions as RecordHandler.
+type RecordHandlerFunc func(ctx context.Context, contractId int, records []maigo.MedicalRecord) error
+
+func (f RecordHandlerFunc) HandleRecords(ctx context.Context, contractId int, records []maigo.MedicalRecord) error {
+	return f(ctx, contractId, records)
+}
+
+// RecordRouter is HookHandler routing records to handlers by category name.
+// Records of categories without handler are ignored. Handlers must be registered
+// before RecordRouter is used.
+//
+//	router := agent.NewRecordRouter()
+//	router.HandleFunc("systolic_pressure", checkPressure)
+//	handler := agent.NewHandler(client, agent.WithHookHandler(router))
+type RecordRouter struct {
+	handlers map[string]RecordHandler
+}
+
+func NewRecordRouter() *RecordRouter {
+	return &RecordRouter{handlers: make(map[string]RecordHandler)}
+}
+
+// Handle registers h for records of category with categoryName.
+func (rr *RecordRouter) Handle(categoryName string, h RecordHandler) {
+	rr.handlers[categoryName] = h
+}
+
+// HandleFunc registers f for records of category with categoryName.
+func (rr *RecordRouter) HandleFunc(categoryName string, f func(ctx context.Context, contractId int, records []maigo.MedicalRecord) error) {
+	rr.Handle(categoryName, RecordHandlerFunc(f))
+}
+
+// Hook passes records of each category to its handler in order of first appearance.
+// All handlers are called; the first error is returned.
+func (rr *RecordRouter) Hook(ctx context.Context, request HookRequest) error {
+	var names []string
+	byCategory := make(map[string][]maigo.MedicalRecord)
+	for _, record := range request.Records {
+		name := record.Category.Name
+		if _, ok := rr.handlers[name]; !ok {
+			continue
+		}
+		if _, ok := byCategory[name]; !ok {
+			names = append(names, name)
+		}
+		byCategory[name] = append(byCategory[name], record)
+	}
+	var firstErr error
+	for _, name := range names {
+		if err := rr.handlers[name].HandleRecords(ctx, request.ContractId, byCategory[name]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/TikhonP/maigo"
+)
+
+// InitRequest is sent by Medsenger when agent is connected to contract.
+type InitRequest struct {
+	ContractId int             `json:"contract_id"`
+	ClinicId   int             `json:"clinic_id"`
+	AgentToken string          `json:"agent_token,omitempty"`
+	Preset     string          `json:"preset,omitempty"` // Name of preset selected by doctor, empty if not set.
+	Params     json.RawMessage `json:"params,omitempty"` // JSON object with agent parameters.
+	Locale     string          `json:"locale,omitempty"`
+}
+
+// DecodeParams unmarshals request parameters to v. Missing parameters leave v unchanged.
+func (r InitRequest) DecodeParams(v any) error {
+	if len(r.Params) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Params, v)
+}
+
+// RemoveRequest is sent by Medsenger when agent is disconnected from contract.
+type RemoveRequest struct {
+	ContractId int `json:"contract_id"`
+}
+
+// Status describes contracts tracked by agent, it is returned on Medsenger status request.
+type Status struct {
+	IsTrackingData     bool     `json:"is_tracking_data"`
+	SupportedScenarios []string `json:"supported_scenarios"`
+	TrackedContracts   []int    `json:"tracked_contracts"`
+}
+
+// SettingsRequest describes request of agent settings page opened from contract.
+type SettingsRequest struct {
+	ContractId int
+	AgentToken string
+	Source     string // Role of user opening the page, e.g. "doctor".
+}
+
+// MessageRequest is sent by Medsenger when patient or doctor writes in contract chat.
+type MessageRequest struct {
+	ContractId int                   `json:"contract_id"`
+	Message    maigo.IncomingMessage `json:"message"`
+
+	client *maigo.Client
+}
+
+// Reply sends message with text to the contract chat the message came from. Returns message id.
+func (r MessageRequest) Reply(ctx context.Context, text string, opts ...maigo.SendMessageOption) (int, error) {
+	return r.client.SendMessageContext(ctx, r.ContractId, text, opts...)
+}
+
+// HookRequest is sent by Medsenger when records of categories agent subscribed to
+// with Client.AddHooksForCategories are added to contract.
+type HookRequest struct {
+	ContractId int                   `json:"contract_id"`
+	Records    []maigo.MedicalRecord `json:"records"`
+}
+
+// OrderRequest is sent by Medsenger when another agent sends order with Client.SendOrder.
+type OrderRequest struct {
+	ContractId int             `json:"contract_id"`
+	Order      string          `json:"order"`
+	SenderId   int             `json:"sender_id,omitempty"` // Identifier of agent sent the order.
+	Params     json.RawMessage `json:"params,omitempty"`    // JSON encoded order parameters.
+}
+
+// OrderResponse is returned to Medsenger on order request.
+type OrderResponse struct {
+	State  string `json:"state"` // "ok" or "error".
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
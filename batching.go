@@ -0,0 +1,159 @@
+package maigo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RecordBatchConfig configures coalescing of concurrent AddRecord calls, see WithRecordBatching.
+type RecordBatchConfig struct {
+	Window      time.Duration // Time to gather records of contract before sending, 50ms if not set.
+	MaxSize     int           // Number of records that triggers sending immediately, 100 if not set.
+	SendTimeout time.Duration // Time limit of AddRecords request of a batch, 30s if not set.
+}
+
+// recordBatcher gathers AddRecord calls per contract and sends them with single AddRecords request.
+type recordBatcher struct {
+	client *Client
+	config RecordBatchConfig
+
+	mu      sync.Mutex
+	pending map[int]*recordBatch
+}
+
+type recordBatch struct {
+	contractId int
+	records    []Record
+	callers    []context.Context
+	results    []chan recordBatchResult
+	timer      *time.Timer
+}
+
+type recordBatchResult struct {
+	id  int
+	err error
+}
+
+func newRecordBatcher(c *Client, config RecordBatchConfig) *recordBatcher {
+	if config.Window <= 0 {
+		config.Window = 50 * time.Millisecond
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = 100
+	}
+	if config.SendTimeout <= 0 {
+		config.SendTimeout = 30 * time.Second
+	}
+	return &recordBatcher{client: c, config: config, pending: make(map[int]*recordBatch)}
+}
+
+// add queues validated record and waits for its id. If ctx is done before batch is sent,
+// record is not sent; if it is done while batch is sent, ctx error is returned but record
+// may still be added.
+func (b *recordBatcher) add(ctx context.Context, contractId int, record Record) (int, error) {
+	result := make(chan recordBatchResult, 1)
+	b.mu.Lock()
+	batch := b.pending[contractId]
+	if batch == nil {
+		batch = &recordBatch{contractId: contractId}
+		batch.timer = time.AfterFunc(b.config.Window, func() { b.flush(batch) })
+		b.pending[contractId] = batch
+	}
+	batch.records = append(batch.records, record)
+	batch.callers = append(batch.callers, ctx)
+	batch.results = append(batch.results, result)
+	full := len(batch.records) >= b.config.MaxSize
+	if full {
+		batch.timer.Stop()
+		delete(b.pending, contractId)
+	}
+	b.mu.Unlock()
+	if full {
+		go b.send(batch)
+	}
+	select {
+	case r := <-result:
+		return r.id, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// flush sends batch if it was not sent because of its size.
+func (b *recordBatcher) flush(batch *recordBatch) {
+	b.mu.Lock()
+	if b.pending[batch.contractId] != batch {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.pending, batch.contractId)
+	b.mu.Unlock()
+	b.send(batch)
+}
+
+// send adds records of batch callers that still wait and passes each of them its record id
+// or error of the whole batch. Request carries values, e.g. tracing span, of the first waiting
+// caller context, but not its cancellation, so it is not aborted when that caller gives up.
+func (b *recordBatcher) send(batch *recordBatch) {
+	var (
+		records []Record
+		results []chan recordBatchResult
+		parent  context.Context
+	)
+	for i, caller := range batch.callers {
+		if caller.Err() != nil {
+			continue
+		}
+		if parent == nil {
+			parent = caller
+		}
+		records = append(records, batch.records[i])
+		results = append(results, batch.results[i])
+	}
+	if len(records) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(valuesContext{parent}, b.config.SendTimeout)
+	defer cancel()
+	ids, err := b.client.AddRecordsContext(ctx, batch.contractId, records)
+	if err == nil && len(ids) != len(records) {
+		err = &APIError{
+			Endpoint:   addRecordsEndpoint.path,
+			StatusCode: http.StatusOK,
+			Message:    fmt.Sprintf("got %d ids for %d records", len(ids), len(records)),
+			kind:       ErrEmptyResponse,
+		}
+	}
+	for i, result := range results {
+		if err != nil {
+			result <- recordBatchResult{err: err}
+		} else {
+			result <- recordBatchResult{id: ids[i]}
+		}
+	}
+}
+
+// valuesContext carries values of parent context without its deadline and cancellation,
+// like context.WithoutCancel of newer Go versions.
+type valuesContext struct {
+	parent context.Context
+}
+
+func (valuesContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (valuesContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (valuesContext) Err() error {
+	return nil
+}
+
+func (c valuesContext) Value(key any) any {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,144 @@
+package maigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeRecordIds answers AddRecords with distinct ids, one per record.
+func writeRecordIds() func(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage) {
+	var (
+		mu   sync.Mutex
+		next int
+	)
+	return func(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage) {
+		var values []json.RawMessage
+		_ = json.Unmarshal(body["values"], &values)
+		if len(values) == 0 {
+			values = make([]json.RawMessage, 1)
+		}
+		mu.Lock()
+		ids := make([]int, len(values))
+		for i := range ids {
+			next++
+			ids[i] = next
+		}
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(ids)
+	}
+}
+
+func addRecordsConcurrently(t *testing.T, c *Client, n int) map[int]bool {
+	t.Helper()
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		ids = make(map[int]bool)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := c.AddRecord(1, "pulse", "60", time.Now(), nil)
+			if err != nil {
+				t.Errorf("AddRecord() error = %v", err)
+				return
+			}
+			mu.Lock()
+			ids[*id] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return ids
+}
+
+func TestRecordBatchingCoalescesCalls(t *testing.T) {
+	server := newTestServer(t, writeRecordIds())
+	c := newTestClient(t, server, WithRecordBatching(RecordBatchConfig{Window: 20 * time.Millisecond, MaxSize: 10}))
+	ids := addRecordsConcurrently(t, c, 30)
+	if len(ids) != 30 {
+		t.Fatalf("got %d distinct ids, want 30", len(ids))
+	}
+	if n := server.count(addRecordsEndpoint.path); n > 6 {
+		t.Fatalf("server got %d requests for 30 records, want batches", n)
+	}
+}
+
+func TestRecordBatchingUsesDerivedClient(t *testing.T) {
+	server := newTestServer(t, writeRecordIds())
+	base := newTestClient(t, server, WithRecordBatching(RecordBatchConfig{}))
+	recorder := NewDryRunRecorder()
+	dry, err := base.With(WithDryRun(recorder))
+	if err != nil {
+		t.Fatalf("With() error = %v", err)
+	}
+	addRecordsConcurrently(t, dry, 5)
+	if n := server.count(addRecordsEndpoint.path); n != 0 {
+		t.Fatalf("dry-run client sent %d requests", n)
+	}
+	if len(recorder.Calls()) == 0 {
+		t.Fatal("dry-run recorder got no calls")
+	}
+}
+
+type parentKey struct{}
+
+// parentTracer records parentKey values of contexts spans are started with.
+type parentTracer struct {
+	mu      sync.Mutex
+	parents []any
+}
+
+func (tr *parentTracer) StartSpan(ctx context.Context, _ SpanInfo) (context.Context, Span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.parents = append(tr.parents, ctx.Value(parentKey{}))
+	return ctx, noopSpan{}
+}
+
+func TestRecordBatchingCarriesCallerContextValues(t *testing.T) {
+	server := newTestServer(t, writeRecordIds())
+	tracer := &parentTracer{}
+	c := newTestClient(t, server, WithTracer(tracer), WithRecordBatching(RecordBatchConfig{Window: 10 * time.Millisecond}))
+	ctx := context.WithValue(context.Background(), parentKey{}, "caller span")
+	if _, err := c.AddRecordContext(ctx, 1, "pulse", "60", time.Now(), nil); err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if len(tracer.parents) != 1 || tracer.parents[0] != "caller span" {
+		t.Fatalf("spans were started with parents %v, want caller span", tracer.parents)
+	}
+}
+
+func TestRecordBatchingDropsRecordsOfCallersThatGaveUp(t *testing.T) {
+	server := newTestServer(t, writeRecordIds())
+	c := newTestClient(t, server, WithRecordBatching(RecordBatchConfig{Window: 50 * time.Millisecond}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.AddRecordContext(ctx, 1, "pulse", "60", time.Now(), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AddRecord() error = %v, want context.DeadlineExceeded", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := server.count(addRecordsEndpoint.path); n != 0 {
+		t.Fatalf("server got %d requests for abandoned batch, want 0", n)
+	}
+}
+
+func TestRecordBatchingSendTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage) {
+		<-release
+	})
+	defer close(release)
+	c := newTestClient(t, server, WithRecordBatching(RecordBatchConfig{Window: time.Millisecond, SendTimeout: 20 * time.Millisecond}))
+	if _, err := c.AddRecord(1, "pulse", "60", time.Now(), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AddRecord() error = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,70 @@
+package maigo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/TikhonP/maigo/internal/breaker"
+	"github.com/TikhonP/maigo/internal/net"
+)
+
+// ErrCircuitOpen is returned without performing request when circuit breaker
+// of the endpoint is open.
+var ErrCircuitOpen = errors.New("maigo: circuit breaker is open")
+
+// CircuitState is a state of endpoint circuit breaker.
+type CircuitState = breaker.State
+
+const (
+	CircuitClosed   = breaker.Closed   // Requests are allowed.
+	CircuitOpen     = breaker.Open     // Requests fail fast with ErrCircuitOpen.
+	CircuitHalfOpen = breaker.HalfOpen // Limited number of trial requests is allowed.
+)
+
+// CircuitBreakerSettings configures circuit breakers tracked per endpoint path.
+// OnStateChange receives endpoint path, e.g. "/api/agents/message", as name.
+type CircuitBreakerSettings = breaker.Settings
+
+// CircuitState returns state of circuit breaker for endpoint path, e.g. "/api/agents/records/add".
+// It returns CircuitClosed if circuit breaker is not configured.
+func (c *Client) CircuitState(endpoint string) CircuitState {
+	if c.breakers == nil {
+		return CircuitClosed
+	}
+	return c.breakers.Get(endpoint).State()
+}
+
+// allowRequest checks circuit breaker of ep. Caller must report request error with done.
+func (c *Client) allowRequest(ep endpoint) (done func(err error), err error) {
+	if c.breakers == nil {
+		return func(error) {}, nil
+	}
+	report, err := c.breakers.Get(ep.path).Allow()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, ep.path)
+	}
+	return func(err error) {
+		switch {
+		case err == nil:
+			report(breaker.Success)
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			report(breaker.Canceled)
+		case isServerFailure(err):
+			report(breaker.Failure)
+		default:
+			report(breaker.Success)
+		}
+	}, nil
+}
+
+// isServerFailure reports whether err means that Medsenger is unavailable or failed.
+// Response 429 is not a failure: Medsenger is healthy and asks Client to slow down.
+func isServerFailure(err error) bool {
+	var statusErr *net.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+	return net.Retryable(err, true)
+}
@@ -0,0 +1,35 @@
+package maigo
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestCircuitBreakerCountsOnlyServerFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   CircuitState
+	}{
+		{"too many requests", http.StatusTooManyRequests, CircuitClosed},
+		{"not found", http.StatusNotFound, CircuitClosed},
+		{"service unavailable", http.StatusServiceUnavailable, CircuitOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, func(w http.ResponseWriter, _ *http.Request, _ map[string]json.RawMessage) {
+				w.WriteHeader(tt.status)
+			})
+			c := newTestClient(t, server, WithCircuitBreaker(CircuitBreakerSettings{FailureThreshold: 2}))
+			for i := 0; i < 2; i++ {
+				if _, err := c.GetContractInfo(1); err == nil {
+					t.Fatal("GetContractInfo() error = nil")
+				}
+			}
+			if state := c.CircuitState(contractInfoEndpoint.path); state != tt.want {
+				t.Fatalf("CircuitState() = %v, want %v", state, tt.want)
+			}
+		})
+	}
+}
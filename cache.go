@@ -0,0 +1,102 @@
+package maigo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/TikhonP/maigo/internal/cache"
+)
+
+// CacheConfig configures caching of rarely changing Medsenger data.
+// Zero TTL disables caching of the resource.
+//
+// Cached values are shared between callers and must not be modified.
+type CacheConfig struct {
+	CategoriesTTL   time.Duration // TTL of GetCategories result.
+	ClinicsTTL      time.Duration // TTL of GetClinicsInfo result.
+	ContractInfoTTL time.Duration // TTL of GetContractInfo result per contract.
+
+	// ServeStale makes Client return expired value when Medsenger is unavailable, e.g. on
+	// connection error, 5xx response or open circuit. Other errors, e.g. ErrContractNotFound,
+	// are returned and remove the value.
+	ServeStale bool
+}
+
+// CacheStats describes usage of a cached resource.
+type CacheStats = cache.Stats
+
+// ClientCacheStats describes usage of Client cache per resource.
+type ClientCacheStats struct {
+	Categories   CacheStats
+	Clinics      CacheStats
+	ContractInfo CacheStats
+}
+
+// cacheKey identifies cached value. Base URL is included, so clients for different
+// Medsenger deployments never share values.
+type cacheKey struct {
+	baseURL    string
+	contractId int
+}
+
+// clientCache holds caches of resources, nil cache means resource is not cached.
+type clientCache struct {
+	categories   *cache.Cache[cacheKey, *Categories]
+	clinics      *cache.Cache[cacheKey, *Clinics]
+	contractInfo *cache.Cache[cacheKey, *ContractInfo]
+}
+
+func newClientCache(config *CacheConfig) clientCache {
+	var cc clientCache
+	if config == nil {
+		return cc
+	}
+	var serveStale func(err error) bool
+	if config.ServeStale {
+		serveStale = isStaleServable
+	}
+	if config.CategoriesTTL > 0 {
+		cc.categories = cache.New[cacheKey, *Categories](config.CategoriesTTL, serveStale)
+	}
+	if config.ClinicsTTL > 0 {
+		cc.clinics = cache.New[cacheKey, *Clinics](config.ClinicsTTL, serveStale)
+	}
+	if config.ContractInfoTTL > 0 {
+		cc.contractInfo = cache.New[cacheKey, *ContractInfo](config.ContractInfoTTL, serveStale)
+	}
+	return cc
+}
+
+// isStaleServable reports whether expired value may be returned instead of err.
+func isStaleServable(err error) bool {
+	return isServerFailure(err) || errors.Is(err, ErrCircuitOpen)
+}
+
+func (c *Client) cacheKey(contractId int) cacheKey {
+	return cacheKey{baseURL: c.baseURL.String(), contractId: contractId}
+}
+
+// InvalidateCategories removes cached categories.
+func (c *Client) InvalidateCategories() {
+	c.cache.categories.InvalidateAll()
+}
+
+// InvalidateClinics removes cached clinics.
+func (c *Client) InvalidateClinics() {
+	c.cache.clinics.InvalidateAll()
+}
+
+// InvalidateContractInfo removes cached information about contract,
+// e.g. when contract is initialized again.
+func (c *Client) InvalidateContractInfo(contractId int) {
+	c.cache.contractInfo.Invalidate(c.cacheKey(contractId))
+}
+
+// CacheStats returns usage statistics of Client cache.
+func (c *Client) CacheStats() ClientCacheStats {
+	return ClientCacheStats{
+		Categories:   c.cache.categories.Stats(),
+		Clinics:      c.cache.clinics.Stats(),
+		ContractInfo: c.cache.contractInfo.Stats(),
+	}
+}
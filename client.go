@@ -1,52 +1,244 @@
 package maigo
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/TikhonP/maigo/internal/api"
 	"github.com/TikhonP/maigo/internal/assert"
+	"github.com/TikhonP/maigo/internal/breaker"
 	pjson "github.com/TikhonP/maigo/internal/json"
-	"github.com/TikhonP/maigo/internal/net"
+	"github.com/TikhonP/maigo/internal/redact"
 )
 
 // Client encapsulates a range of functionality related to
 // actions for Medsenger AI actions.
+//
+// Client configuration is immutable and Client is safe for concurrent use.
 type Client struct {
-	apiKey string // Secret assigned to agent.
-	host   string // Medsenger service target hostname.
+	options    *clientOptions // Configuration Client was created with, never modified.
+	keys       KeyProvider    // Supplies secret assigned to agent.
+	baseURL    *url.URL       // Medsenger service URL that endpoint paths are joined to.
+	httpClient *http.Client   // Client used to perform HTTP requests.
+
+	retryPolicy RetryPolicy  // Policy of repeating failed requests.
+	limiter     *limiter     // Rate limits and concurrency caps, nil if not configured.
+	breakers    *breaker.Set // Circuit breakers per endpoint, nil if not configured.
+	logger      Logger       // Receives log of each request, nil if not configured.
+	logBodies   bool         // Whether logs include redacted bodies.
+	tracer      Tracer       // Starts span for each call, nil if not configured.
+	metrics     Metrics      // Receives request measurements, nil if not configured.
+
+	maxResponseSize int64         // Limit of response body size, no limit if 0.
+	cache           clientCache   // Caches of rarely changing data.
+	outbox          *Outbox       // Queue of failed write requests, nil if not configured.
+	dedup           *deduplicator // Idempotency keys deduplication, nil if not configured.
+	dryRun          *dryRun       // Interceptor of write requests, nil if not configured.
+	hosts           *hostPool     // Health of failover hosts, nil if not configured.
+	onUnauthorized  func(ctx context.Context, err *APIError)
+	batcher         *recordBatcher // Coalescer of AddRecord calls, nil if not configured.
 }
 
+// DebugData describes Client configuration. Api key is redacted.
 func (c *Client) DebugData() string {
-	return fmt.Sprintf("apiKey: %s..., host: %s", c.apiKey[:10], c.host)
+	apiKey, err := c.keys.APIKey(context.Background())
+	if err != nil {
+		apiKey = err.Error()
+	} else {
+		apiKey = redact.Secret(apiKey)
+	}
+	return fmt.Sprintf("apiKey: %s, baseURL: %s", apiKey, c.baseURL)
 }
 
-// urlAppendingPath generates *url.URL based on Client.host and provided path.
+// urlAppendingPath generates *url.URL joining Client.baseURL and provided path.
 func (c *Client) urlAppendingPath(path string) *url.URL {
-	return &url.URL{Scheme: "https", Host: c.host, Path: path}
+	u := *c.baseURL
+	u.Path += path
+	return &u
 }
 
+// tokenAndContractRequest returns request bound to contract. Api key is set
+// from Client KeyProvider before each attempt.
 func (c *Client) tokenAndContractRequest(contractId int) api.TokenAndContractRequest {
-	return api.TokenAndContractRequest{
-		TokenOnlyRequest: api.TokenOnlyRequest{ApiKey: c.apiKey},
-		ContractId:       contractId,
+	return api.TokenAndContractRequest{ContractId: contractId}
+}
+
+// NewClient creates Medsenger AI Client with provided apiKey and options.
+// apiKey must be empty if WithKeyProvider is set.
+//
+// Default environment is Production. Invalid configuration is reported as *ConfigError.
+// If WithStartupProbe is set, NewClient also checks that Medsenger accepts apiKey.
+func NewClient(apiKey string, opts ...ClientOption) (*Client, error) {
+	co := newClientOptions(opts...)
+	var configErr ConfigError
+	keys := co.keyProvider
+	switch {
+	case keys != nil:
+		if apiKey != "" {
+			configErr.add("apiKey", "must be empty when key provider is set")
+		}
+	case len(apiKey) <= 10:
+		configErr.add("apiKey", "must be longer than 10 characters")
+	case strings.TrimSpace(apiKey) != apiKey:
+		configErr.add("apiKey", "must not have leading or trailing spaces")
+	default:
+		keys = StaticKey(apiKey)
+	}
+	c, err := newClient(co, keys, nil, co, &configErr)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.probe(co.startupProbeTimeout); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient creates Client from co. If base is not nil, components of base not configured
+// by options in delta are shared with the new Client.
+func newClient(co *clientOptions, keys KeyProvider, base *Client, delta *clientOptions, configErr *ConfigError) (*Client, error) {
+	baseURL := co.resolveBaseURL(configErr)
+	failoverURLs := co.resolveFailoverURLs(configErr)
+	co.validateLimits(configErr)
+	if len(configErr.Problems) > 0 {
+		return nil, configErr
+	}
+	c := &Client{
+		options:     co,
+		keys:        keys,
+		baseURL:     baseURL,
+		retryPolicy: co.retryPolicy,
+		logger:      co.logger,
+		logBodies:   co.logBodies,
+		tracer:      co.tracer,
+		metrics:     co.metrics,
+
+		maxResponseSize: co.maxResponseSize,
+		onUnauthorized:  co.onUnauthorized,
+	}
+	if base != nil {
+		c.httpClient, c.limiter, c.breakers = base.httpClient, base.limiter, base.breakers
+		c.cache, c.outbox, c.dedup, c.dryRun, c.hosts = base.cache, base.outbox, base.dedup, base.dryRun, base.hosts
+	}
+	if base == nil || delta.configuresTransport() {
+		c.httpClient = co.newHTTPClient()
+	}
+	if base == nil || delta.configuresLimits() {
+		c.limiter = newLimiter(co)
+	}
+	// Breakers track health of endpoints on particular hosts, so they are not shared
+	// with Client sending requests to other hosts.
+	if base == nil || delta.breaker != nil || delta.configuresHosts() {
+		c.breakers = nil
+		if co.breaker != nil {
+			c.breakers = breaker.NewSet(*co.breaker)
+		}
+	}
+	// Cached responses, idempotency results and queued requests belong to api key,
+	// so they are not shared with Client using other key.
+	tenantChanged := base != nil && delta.keyProvider != nil
+	if base == nil || delta.cache != nil || tenantChanged {
+		c.cache = newClientCache(co.cache)
+	}
+	if base == nil || delta.idempotencyStore != nil || tenantChanged {
+		c.dedup = nil
+		if co.idempotencyStore != nil {
+			scope, err := keyFingerprint(keys)
+			if err != nil {
+				return nil, err
+			}
+			c.dedup = newDeduplicator(co.idempotencyStore, co.idempotencyWindow, scope)
+		}
+	}
+	if base == nil || delta.dryRunSink != nil {
+		c.dryRun = nil
+		if co.dryRunSink != nil {
+			c.dryRun = &dryRun{sink: co.dryRunSink}
+		}
+	}
+	if base == nil || delta.configuresHosts() || delta.configuresTransport() {
+		c.hosts = nil
+		if co.failover != nil {
+			c.hosts = newHostPool(baseURL, failoverURLs, *co.failover, c.checkHost)
+		}
+	}
+	if co.recordBatch != nil {
+		// Batcher sends records with its Client, so it is never shared with base.
+		c.batcher = newRecordBatcher(c, *co.recordBatch)
+	}
+	if base == nil || delta.outboxStore != nil || tenantChanged {
+		c.outbox = nil
+		if tenantChanged && delta.outboxStore == nil {
+			co.outboxStore = nil
+		}
+		if co.outboxStore != nil {
+			outbox, err := newOutbox(c, co.outboxStore, co.outboxConfig)
+			if err != nil {
+				return nil, fmt.Errorf("maigo: outbox: %w", err)
+			}
+			c.outbox = outbox
+		}
+	}
+	return c, nil
+}
+
+// probe checks that Medsenger accepts api key if timeout is positive.
+func (c *Client) probe(timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := c.GetCategoriesContext(ctx); err != nil {
+		return fmt.Errorf("maigo: startup probe: %w", err)
 	}
+	return nil
 }
 
-// Init creates Medsenger AI Client with provided apiKey.
+// With returns a copy of Client with opts applied on top of its configuration.
+// Client itself is never modified, so both clients can be used concurrently.
 //
-// Default host is "medsenger.ru". Host can be modified using Client.UpdateHost method.
-func Init(apiKey string) *Client {
-	assert.Assert(len(apiKey) > 10, "apiKey must be at least 10 characters long")
-	return &Client{apiKey: apiKey, host: "medsenger.ru"}
+// The copy shares transport, limits, circuit breakers, caches, outbox, idempotency store,
+// dry-run sink and host health with Client unless opts configure them anew.
+// If opts set base URL or failover hosts, the copy gets its own circuit breakers and host health.
+// Shared outbox replays entries using Client configuration.
+//
+// If opts set WithKeyProvider, the copy acts for other agent: it gets its own cache and
+// idempotency results, and has no outbox unless WithOutbox with other store is set too.
+func (c *Client) With(opts ...ClientOption) (*Client, error) {
+	co := c.options.clone()
+	delta := &clientOptions{}
+	for _, opt := range opts {
+		opt.apply(co)
+		opt.apply(delta)
+	}
+	keys := c.keys
+	if delta.keyProvider != nil {
+		keys = delta.keyProvider
+	}
+	var configErr ConfigError
+	derived, err := newClient(co, keys, c, delta, &configErr)
+	if err != nil {
+		return nil, err
+	}
+	if err := derived.probe(delta.startupProbeTimeout); err != nil {
+		return nil, err
+	}
+	return derived, nil
 }
 
-// UpdateHost modifies host for all Client requests.
-func (c *Client) UpdateHost(host string) *Client {
-	c.host = host
+// Init creates Medsenger AI Client with provided apiKey and options.
+// It terminates the program if configuration is invalid, use NewClient to handle errors.
+//
+// Default host is "medsenger.ru". Client with other host can be derived using Client.With method.
+func Init(apiKey string, opts ...ClientOption) *Client {
+	c, err := NewClient(apiKey, opts...)
+	assert.Assert(err == nil, fmt.Sprint(err))
 	return c
 }
 
@@ -54,20 +246,38 @@ type emptyResponse struct{}
 
 // GetContractInfo fetches information about contract with provided contractId.
 func (c *Client) GetContractInfo(contractId int) (*ContractInfo, error) {
-	request := c.tokenAndContractRequest(contractId)
-	reqUrl := c.urlAppendingPath("/api/agents/patient/info")
-	return net.MakeRequest[api.TokenAndContractRequest, ContractInfo](reqUrl, request)
+	return c.GetContractInfoContext(context.Background(), contractId)
+}
+
+// GetContractInfoContext is like GetContractInfo but uses ctx for the request.
+func (c *Client) GetContractInfoContext(ctx context.Context, contractId int) (*ContractInfo, error) {
+	return c.cache.contractInfo.Get(ctx, c.cacheKey(contractId), func(ctx context.Context) (*ContractInfo, error) {
+		request := c.tokenAndContractRequest(contractId)
+		return makeRequest[api.TokenAndContractRequest, ContractInfo](ctx, c, contractInfoEndpoint, request)
+	})
 }
 
 // GetClinicsInfo fetches all clinics.
 func (c *Client) GetClinicsInfo() (*Clinics, error) {
-	request := api.TokenOnlyRequest{ApiKey: c.apiKey}
-	reqUrl := c.urlAppendingPath("/api/agents/clinics")
-	return net.MakeRequest[api.TokenOnlyRequest, Clinics](reqUrl, request)
+	return c.GetClinicsInfoContext(context.Background())
+}
+
+// GetClinicsInfoContext is like GetClinicsInfo but uses ctx for the request.
+func (c *Client) GetClinicsInfoContext(ctx context.Context) (*Clinics, error) {
+	return c.cache.clinics.Get(ctx, c.cacheKey(0), func(ctx context.Context) (*Clinics, error) {
+		request := api.TokenOnlyRequest{}
+		return makeRequest[api.TokenOnlyRequest, Clinics](ctx, c, clinicsEndpoint, request)
+	})
 }
 
 // SendMessage sends message in contract chat.
 func (c *Client) SendMessage(contractId int, text string, opts ...SendMessageOption) (msgId int, err error) {
+	return c.SendMessageContext(context.Background(), contractId, text, opts...)
+}
+
+// SendMessageContext is like SendMessage but uses ctx for the request.
+// Message is sent once per idempotency key set with ContextWithIdempotencyKey.
+func (c *Client) SendMessageContext(ctx context.Context, contractId int, text string, opts ...SendMessageOption) (msgId int, err error) {
 	type Request struct {
 		api.TokenAndContractRequest
 		Message *sendMessageOptions `json:"message"`
@@ -80,53 +290,151 @@ func (c *Client) SendMessage(contractId int, text string, opts ...SendMessageOpt
 		TokenAndContractRequest: c.tokenAndContractRequest(contractId),
 		Message:                 newSendMessageOptions(text, opts...),
 	}
-	reqUrl := c.urlAppendingPath("/api/agents/message")
-	resp, err := net.MakeRequest[Request, Response](reqUrl, request)
-	return resp.Id, err
+	if err := validateMessage(contractId, request.Message); err != nil {
+		return 0, err
+	}
+	if err := request.Message.signAction(contractId); err != nil {
+		return 0, err
+	}
+	ids, err := c.deduplicate(ctx, "SendMessage", contractId, func(ctx context.Context) ([]int, error) {
+		resp, err := writeRequest[Request, Response](ctx, c, messageEndpoint, request)
+		if err != nil {
+			return nil, err
+		}
+		return []int{resp.Id}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
 }
 
 // OutDateMessage hides the message from a chat.
 func (c *Client) OutDateMessage(contractId int, messageId int) error {
+	return c.OutDateMessageContext(context.Background(), contractId, messageId)
+}
+
+// OutDateMessageContext is like OutDateMessage but uses ctx for the request.
+func (c *Client) OutDateMessageContext(ctx context.Context, contractId int, messageId int) error {
 	type Request struct {
 		api.TokenAndContractRequest
 		MessageId int `json:"message_id"`
 	}
+	if err := validateContractId(contractId); err != nil {
+		return err
+	}
+	if messageId <= 0 {
+		return &ValidationError{Field: "messageId", Reason: "must be positive"}
+	}
 	request := Request{TokenAndContractRequest: c.tokenAndContractRequest(contractId), MessageId: messageId}
-	reqUrl := c.urlAppendingPath("/api/agents/message/outdate")
-	return net.MakeRequestWithEmptyResponse(reqUrl, request)
+	return makeRequestWithEmptyResponse(ctx, c, outdateMessageEndpoint, request)
 }
 
 // GetCategories fetches all medical records categories.
 func (c *Client) GetCategories() (*Categories, error) {
-	request := api.TokenOnlyRequest{ApiKey: c.apiKey}
-	reqUrl := c.urlAppendingPath("/api/agents/records/categories")
-	return net.MakeRequest[api.TokenOnlyRequest, Categories](reqUrl, request)
+	return c.GetCategoriesContext(context.Background())
+}
+
+// GetCategoriesContext is like GetCategories but uses ctx for the request.
+func (c *Client) GetCategoriesContext(ctx context.Context) (*Categories, error) {
+	return c.cache.categories.Get(ctx, c.cacheKey(0), func(ctx context.Context) (*Categories, error) {
+		request := api.TokenOnlyRequest{}
+		return makeRequest[api.TokenOnlyRequest, Categories](ctx, c, categoriesEndpoint, request)
+	})
 }
 
 // GetAvailableCategories fetches all available medical records categories.
 func (c *Client) GetAvailableCategories(contractId int) (*Categories, error) {
+	return c.GetAvailableCategoriesContext(context.Background(), contractId)
+}
+
+// GetAvailableCategoriesContext is like GetAvailableCategories but uses ctx for the request.
+func (c *Client) GetAvailableCategoriesContext(ctx context.Context, contractId int) (*Categories, error) {
 	request := c.tokenAndContractRequest(contractId)
-	reqUrl := c.urlAppendingPath("/api/agents/records/available_categories")
-	return net.MakeRequest[api.TokenAndContractRequest, Categories](reqUrl, request)
+	return makeRequest[api.TokenAndContractRequest, Categories](ctx, c, availableCategoriesEndpoint, request)
 }
 
 // GetRecords fetches medical records by contractId.
 // By default all recrds sorted ascending by time. So if you need to get latest record you need to set limit to 1.
 func (c *Client) GetRecords(contractId int, opts ...GetRecordsOption) ([]MedicalRecord, error) {
+	return c.GetRecordsContext(context.Background(), contractId, opts...)
+}
+
+// GetRecordsContext is like GetRecords but uses ctx for the request.
+func (c *Client) GetRecordsContext(ctx context.Context, contractId int, opts ...GetRecordsOption) ([]MedicalRecord, error) {
 	request := getRecordsOptions{
 		TokenAndContractRequest: c.tokenAndContractRequest(contractId),
 	}
 	applyGetRecordsOptions(&request, opts...)
-	reqUrl := c.urlAppendingPath("/api/agents/records/get/all")
-	records, err := net.MakeRequest[getRecordsOptions, []MedicalRecord](reqUrl, request)
+	records, err := makeRequest[getRecordsOptions, []MedicalRecord](ctx, c, recordsEndpoint, request)
 	if err != nil {
 		return nil, err
 	}
 	return *records, nil
 }
 
+// EachRecord is like GetRecordsContext but decodes records one by one and calls fn for each of them,
+// so the whole response is never loaded into memory. Error returned by fn stops iteration and is returned.
+//
+// Only requests that did not reach Medsenger, e.g. failed to connect or got 429, are retried,
+// so fn never gets the same record twice. Unlike GetRecordsContext, 5xx responses and timeouts
+// are not retried even before the first record is decoded.
+func (c *Client) EachRecord(ctx context.Context, contractId int, fn func(MedicalRecord) error, opts ...GetRecordsOption) error {
+	request := getRecordsOptions{
+		TokenAndContractRequest: c.tokenAndContractRequest(contractId),
+	}
+	applyGetRecordsOptions(&request, opts...)
+	// Retrying only requests that did not reach the server guarantees that fn never gets record twice.
+	ep := recordsEndpoint
+	ep.idempotent = false
+	var fnErr error
+	err := makeStreamRequest(ctx, c, ep, request, func(decoder *json.Decoder) error {
+		return decodeArray(decoder, func(decoder *json.Decoder) error {
+			var record MedicalRecord
+			if err := decoder.Decode(&record); err != nil {
+				return err
+			}
+			fnErr = fn(record)
+			return fnErr
+		})
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+// StreamRecords is like EachRecord but sends records to returned channel with buffer size.
+// Both channels are closed after the last record; error channel receives at most one error.
+// Cancel ctx to stop reading before all records are received.
+func (c *Client) StreamRecords(ctx context.Context, contractId int, buffer int, opts ...GetRecordsOption) (<-chan MedicalRecord, <-chan error) {
+	records := make(chan MedicalRecord, buffer)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(records)
+		err := c.EachRecord(ctx, contractId, func(record MedicalRecord) error {
+			select {
+			case records <- record:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, opts...)
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return records, errc
+}
+
 // GetRecord fetches a record by contractId and recordId.
 func (c *Client) GetRecord(contractId int, recordId int) (*MedicalRecord, error) {
+	return c.GetRecordContext(context.Background(), contractId, recordId)
+}
+
+// GetRecordContext is like GetRecord but uses ctx for the request.
+func (c *Client) GetRecordContext(ctx context.Context, contractId int, recordId int) (*MedicalRecord, error) {
 	type Request struct {
 		api.TokenAndContractRequest
 		RecordId int `json:"record_id"`
@@ -135,52 +443,128 @@ func (c *Client) GetRecord(contractId int, recordId int) (*MedicalRecord, error)
 		TokenAndContractRequest: c.tokenAndContractRequest(contractId),
 		RecordId:                recordId,
 	}
-	reqUrl := c.urlAppendingPath("/api/agents/records/get")
-	return net.MakeRequest[Request, MedicalRecord](reqUrl, request)
+	return makeRequest[Request, MedicalRecord](ctx, c, recordEndpoint, request)
+}
+
+// AddHooksForCategories subscribes agent to records of categories with categoryNames added to contract.
+// Medsenger sends such records to agent hook callback, see agent.WithHookHandler.
+func (c *Client) AddHooksForCategories(contractId int, categoryNames []string) error {
+	return c.AddHooksForCategoriesContext(context.Background(), contractId, categoryNames)
+}
+
+// AddHooksForCategoriesContext is like AddHooksForCategories but uses ctx for the request.
+func (c *Client) AddHooksForCategoriesContext(ctx context.Context, contractId int, categoryNames []string) error {
+	return c.updateHooks(ctx, addHooksEndpoint, contractId, categoryNames)
 }
 
-func (c *Client) AddHooksForCategories(contractId int) {
-	// TODO: implement it
-	panic("not implemented")
+// RemoveHooksForCategories unsubscribes agent from records of categories with categoryNames.
+func (c *Client) RemoveHooksForCategories(contractId int, categoryNames []string) error {
+	return c.RemoveHooksForCategoriesContext(context.Background(), contractId, categoryNames)
 }
 
-func (c *Client) RemoveHooksForCategories(contractId int) {
-	// TODO: implement it
-	panic("not implemented")
+// RemoveHooksForCategoriesContext is like RemoveHooksForCategories but uses ctx for the request.
+func (c *Client) RemoveHooksForCategoriesContext(ctx context.Context, contractId int, categoryNames []string) error {
+	return c.updateHooks(ctx, removeHooksEndpoint, contractId, categoryNames)
+}
+
+func (c *Client) updateHooks(ctx context.Context, ep endpoint, contractId int, categoryNames []string) error {
+	type Request struct {
+		api.TokenAndContractRequest
+		Names []string `json:"names"`
+	}
+	if err := validateCategoryNames(contractId, categoryNames); err != nil {
+		return err
+	}
+	request := Request{TokenAndContractRequest: c.tokenAndContractRequest(contractId), Names: categoryNames}
+	return makeRequestWithEmptyResponse(ctx, c, ep, request)
+}
+
+// SendOrder sends order with params to agent with receiverAgentId connected to contract.
+// If receiverAgentId is 0, order is sent to all agents of the contract. params are encoded as JSON, may be nil.
+func (c *Client) SendOrder(contractId int, order string, receiverAgentId int, params any) error {
+	return c.SendOrderContext(context.Background(), contractId, order, receiverAgentId, params)
+}
+
+// SendOrderContext is like SendOrder but uses ctx for the request.
+func (c *Client) SendOrderContext(ctx context.Context, contractId int, order string, receiverAgentId int, params any) error {
+	type Request struct {
+		api.TokenAndContractRequest
+		Order      string          `json:"order"`
+		ReceiverId int             `json:"receiver_id,omitempty"`
+		Params     json.RawMessage `json:"params,omitempty"`
+	}
+	if err := validateOrder(contractId, order, receiverAgentId); err != nil {
+		return err
+	}
+	request := Request{
+		TokenAndContractRequest: c.tokenAndContractRequest(contractId),
+		Order:                   order,
+		ReceiverId:              receiverAgentId,
+	}
+	if params != nil {
+		encodedParams, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		request.Params = encodedParams
+	}
+	return makeRequestWithEmptyResponse(ctx, c, orderEndpoint, request)
 }
 
 // SendRecordAddition commit addition to a record.
 func (c *Client) SendRecordAddition(contractId int, recordId int, note string) error {
+	return c.SendRecordAdditionContext(context.Background(), contractId, recordId, note)
+}
+
+// SendRecordAdditionContext is like SendRecordAddition but uses ctx for the request.
+func (c *Client) SendRecordAdditionContext(ctx context.Context, contractId int, recordId int, note string) error {
 	type Request struct {
 		api.TokenAndContractRequest
 		RecordId int    `json:"record_id"`
 		Note     string `json:"addition"`
 	}
+	if err := validateContractId(contractId); err != nil {
+		return err
+	}
+	if recordId <= 0 {
+		return &ValidationError{Field: "recordId", Reason: "must be positive"}
+	}
 	request := Request{
 		TokenAndContractRequest: c.tokenAndContractRequest(contractId),
 		RecordId:                recordId,
 		Note:                    note,
 	}
-	reqUrl := c.urlAppendingPath("/api/agents/records/addition")
-	return net.MakeRequestWithEmptyResponse(reqUrl, request)
+	return writeRequestWithEmptyResponse(ctx, c, recordAdditionEndpoint, request)
 }
 
 // GetAgentTokenForContractId fetches agent token for contract.
 func (c *Client) GetAgentTokenForContractId(contractId int) (*AgentToken, error) {
+	return c.GetAgentTokenForContractIdContext(context.Background(), contractId)
+}
+
+// GetAgentTokenForContractIdContext is like GetAgentTokenForContractId but uses ctx for the request.
+func (c *Client) GetAgentTokenForContractIdContext(ctx context.Context, contractId int) (*AgentToken, error) {
 	request := c.tokenAndContractRequest(contractId)
-	reqUrl := c.urlAppendingPath("/api/agents/token")
-	return net.MakeRequest[api.TokenAndContractRequest, AgentToken](reqUrl, request)
+	return makeRequest[api.TokenAndContractRequest, AgentToken](ctx, c, agentTokenEndpoint, request)
 }
 
 // AddRecord adds medical record to Medsenger medical records table for contract. Returns recordId.
 func (c *Client) AddRecord(contractId int, categoryName, value string, recordTime time.Time, params *json.Marshaler) (*int, error) {
+	return c.AddRecordContext(context.Background(), contractId, categoryName, value, recordTime, params)
+}
+
+// AddRecordContext is like AddRecord but uses ctx for the request.
+//
+// Idempotency key set with ContextWithIdempotencyKey is added to params as "external_id".
+// If WithRecordBatching is set, calls without idempotency key are coalesced into AddRecords requests.
+func (c *Client) AddRecordContext(ctx context.Context, contractId int, categoryName, value string, recordTime time.Time, params *json.Marshaler) (*int, error) {
 	type Request struct {
 		api.TokenAndContractRequest
 		CategoryName string          `json:"category_name"`
 		Value        string          `json:"value"`
 		ReturnId     bool            `json:"return_id"`
 		Time         pjson.Timestamp `json:"time"`
-		Params       *json.Marshaler `json:"params,omitempty"`
+		Params       json.RawMessage `json:"params,omitempty"`
 	}
 	request := Request{
 		TokenAndContractRequest: c.tokenAndContractRequest(contractId),
@@ -188,23 +572,62 @@ func (c *Client) AddRecord(contractId int, categoryName, value string, recordTim
 		Value:                   value,
 		ReturnId:                true,
 		Time:                    pjson.Timestamp{Time: recordTime},
-		Params:                  params,
 	}
-	reqUrl := c.urlAppendingPath("/api/agents/records/add")
-	ids, err := net.MakeRequest[Request, []int](reqUrl, request)
-	if err != nil {
+	if params != nil && *params != nil {
+		encodedParams, err := (*params).MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		request.Params = encodedParams
+	}
+	record := Record{CategoryName: categoryName, Value: value, Time: request.Time, Params: request.Params}
+	if err := validateContractId(contractId); err != nil {
+		return nil, err
+	}
+	if err := validateRecord(record); err != nil {
 		return nil, err
 	}
-	if len(*ids) == 0 {
-		return nil, errors.New("empty id response")
+	key, hasKey := IdempotencyKeyFromContext(ctx)
+	if !hasKey && c.batcher != nil {
+		id, err := c.batcher.add(ctx, contractId, record)
+		if err != nil {
+			return nil, err
+		}
+		return &id, nil
+	}
+	if hasKey {
+		encodedParams, err := paramsWithExternalId(request.Params, key)
+		if err != nil {
+			return nil, err
+		}
+		request.Params = encodedParams
+	}
+	ids, err := c.deduplicate(ctx, "AddRecord", contractId, func(ctx context.Context) ([]int, error) {
+		ids, err := writeRequest[Request, []int](ctx, c, addRecordsEndpoint, request)
+		if err != nil {
+			return nil, err
+		}
+		if len(*ids) == 0 {
+			return nil, &APIError{
+				Endpoint:   addRecordsEndpoint.path,
+				StatusCode: http.StatusOK,
+				Message:    "empty id response",
+				kind:       ErrEmptyResponse,
+			}
+		}
+		return (*ids)[:1], nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return &(*ids)[0], nil
+	return &ids[0], nil
 }
 
 type Record struct {
 	CategoryName string          `json:"category_name"`
 	Value        string          `json:"value"`
 	Time         pjson.Timestamp `json:"time"`
+	Params       json.RawMessage `json:"params,omitempty"` // Optional JSON object with record parameters.
 }
 
 func NewRecord(categoryName, value string, time time.Time) Record {
@@ -217,6 +640,14 @@ func NewRecord(categoryName, value string, time time.Time) Record {
 
 // AddRecords adds multiple records to Medsenger medical records table for contract. Returns recordIds.
 func (c *Client) AddRecords(contractId int, records []Record) ([]int, error) {
+	return c.AddRecordsContext(context.Background(), contractId, records)
+}
+
+// AddRecordsContext is like AddRecords but uses ctx for the request.
+//
+// Idempotency key set with ContextWithIdempotencyKey is added to params of each record
+// as "external_id" in form "key:index".
+func (c *Client) AddRecordsContext(ctx context.Context, contractId int, records []Record) ([]int, error) {
 	type Request struct {
 		api.TokenAndContractRequest
 		Values   []Record `json:"values"`
@@ -227,11 +658,21 @@ func (c *Client) AddRecords(contractId int, records []Record) ([]int, error) {
 		Values:                  records,
 		ReturnId:                true,
 	}
-	reqUrl := c.urlAppendingPath("/api/agents/records/add")
-	ids, err := net.MakeRequest[Request, []int](reqUrl, request)
-	if err != nil {
+	if err := validateRecords(contractId, records); err != nil {
 		return nil, err
 	}
-	return *ids, nil
+	if key, ok := IdempotencyKeyFromContext(ctx); ok {
+		withIds, err := recordsWithExternalIds(records, key)
+		if err != nil {
+			return nil, err
+		}
+		request.Values = withIds
+	}
+	return c.deduplicate(ctx, "AddRecords", contractId, func(ctx context.Context) ([]int, error) {
+		ids, err := writeRequest[Request, []int](ctx, c, addRecordsEndpoint, request)
+		if err != nil {
+			return nil, err
+		}
+		return *ids, nil
+	})
 }
-
@@ -0,0 +1,495 @@
+package maigo
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type clientOptions struct {
+	baseURL      string
+	scheme       string // Overrides scheme of baseURL if not empty.
+	host         string // Overrides host of baseURL if not empty.
+	httpClient   *http.Client
+	transport    http.RoundTripper
+	timeout      time.Duration
+	proxy        func(*http.Request) (*url.URL, error)
+	rootCAs      *x509.CertPool
+	certificates []tls.Certificate
+	retryPolicy  RetryPolicy
+	limits       limits
+	groupLimits  map[EndpointGroup]limits
+	waitObserver WaitObserver
+	breaker      *CircuitBreakerSettings
+	logger       Logger
+	logBodies    bool
+	tracer       Tracer
+	metrics      Metrics
+
+	maxResponseSize     int64
+	startupProbeTimeout time.Duration
+	cache               *CacheConfig
+	outboxStore         OutboxStore
+	outboxConfig        OutboxConfig
+	idempotencyStore    IdempotencyStore
+	idempotencyWindow   time.Duration
+	dryRunSink          DryRunSink
+	failover            *FailoverConfig
+	keyProvider         KeyProvider
+	onUnauthorized      func(ctx context.Context, err *APIError)
+	recordBatch         *RecordBatchConfig
+}
+
+func newClientOptions(opts ...ClientOption) *clientOptions {
+	co := &clientOptions{baseURL: productionBaseURL}
+	for _, opt := range opts {
+		opt.apply(co)
+	}
+	return co
+}
+
+// clone returns a copy of o that can be modified without affecting o.
+func (o *clientOptions) clone() *clientOptions {
+	co := *o
+	if o.groupLimits != nil {
+		co.groupLimits = make(map[EndpointGroup]limits, len(o.groupLimits))
+		for group, l := range o.groupLimits {
+			co.groupLimits[group] = l
+		}
+	}
+	return &co
+}
+
+// validateLimits adds problems of rate limits and concurrency caps to configErr.
+func (o *clientOptions) validateLimits(configErr *ConfigError) {
+	validate := func(field string, l limits) {
+		if l.rate != nil {
+			if !(l.rate.rate > 0) || math.IsInf(l.rate.rate, 1) {
+				configErr.add(field+".rate", fmt.Sprintf("must be positive finite number, got %v", l.rate.rate))
+			}
+			if l.rate.burst < 1 {
+				configErr.add(field+".burst", fmt.Sprintf("must be at least 1, got %d", l.rate.burst))
+			}
+		}
+		if l.maxInFlight < 0 {
+			configErr.add(field+".maxInFlight", fmt.Sprintf("must not be negative, got %d", l.maxInFlight))
+		}
+	}
+	validate("limits", o.limits)
+	for group, l := range o.groupLimits {
+		validate(fmt.Sprintf("groupLimits[%s]", group), l)
+	}
+}
+
+// configuresTransport reports whether o sets any option of HTTP client.
+func (o *clientOptions) configuresTransport() bool {
+	return o.httpClient != nil || o.transport != nil || o.timeout != 0 || o.proxy != nil ||
+		o.rootCAs != nil || o.certificates != nil
+}
+
+// configuresLimits reports whether o sets any rate limit or concurrency cap.
+func (o *clientOptions) configuresLimits() bool {
+	return o.limits != (limits{}) || o.groupLimits != nil || o.waitObserver != nil
+}
+
+// configuresHosts reports whether o sets base URL or failover hosts.
+func (o *clientOptions) configuresHosts() bool {
+	return o.baseURL != "" || o.scheme != "" || o.host != "" || o.failover != nil
+}
+
+func (o *clientOptions) groupLimit(group EndpointGroup) limits {
+	if o.groupLimits == nil {
+		o.groupLimits = make(map[EndpointGroup]limits)
+	}
+	return o.groupLimits[group]
+}
+
+// resolveBaseURL parses base URL and applies scheme and host overrides.
+// Problems are added to configErr.
+func (o *clientOptions) resolveBaseURL(configErr *ConfigError) *url.URL {
+	return parseBaseURL(o.baseURL, o.scheme, o.host, "", configErr)
+}
+
+// resolveFailoverURLs parses backup base URLs. Problems are added to configErr.
+func (o *clientOptions) resolveFailoverURLs(configErr *ConfigError) []*url.URL {
+	if o.failover == nil {
+		return nil
+	}
+	urls := make([]*url.URL, len(o.failover.BaseURLs))
+	for i, raw := range o.failover.BaseURLs {
+		urls[i] = parseBaseURL(raw, "", "", fmt.Sprintf("failover[%d].", i), configErr)
+	}
+	return urls
+}
+
+// parseBaseURL parses raw base URL and applies scheme and host overrides if they are not empty.
+// Problems are added to configErr with fields prefixed by fieldPrefix.
+func parseBaseURL(raw, scheme, host, fieldPrefix string, configErr *ConfigError) *url.URL {
+	u, err := url.Parse(raw)
+	if err != nil {
+		configErr.add(fieldPrefix+"baseURL", err.Error())
+		return nil
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		configErr.add(fieldPrefix+"baseURL", fmt.Sprintf("must not contain user info, query or fragment, got %q", raw))
+	}
+	if scheme != "" {
+		u.Scheme = scheme
+	}
+	if host != "" {
+		u.Host = host
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		configErr.add(fieldPrefix+"scheme", fmt.Sprintf("must be \"https\" or \"http\", got %q", u.Scheme))
+	}
+	if err := validateHost(u.Host); err != nil {
+		configErr.add(fieldPrefix+"host", err.Error())
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u
+}
+
+// validateHost checks that host is "hostname" or "hostname:port".
+func validateHost(host string) error {
+	if host == "" {
+		return errors.New("must not be empty")
+	}
+	u, err := url.Parse("https://" + host)
+	if err != nil || u.Host != host || u.Hostname() == "" || u.User != nil {
+		return fmt.Errorf("must be hostname with optional port, got %q", host)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+	return nil
+}
+
+// newHTTPClient builds *http.Client that Client uses for all requests.
+func (o *clientOptions) newHTTPClient() *http.Client {
+	hc := &http.Client{}
+	if o.httpClient != nil {
+		*hc = *o.httpClient
+	}
+	if o.transport != nil {
+		hc.Transport = o.transport
+	}
+	if o.timeout > 0 {
+		hc.Timeout = o.timeout
+	}
+	if o.proxy != nil || o.rootCAs != nil || len(o.certificates) > 0 {
+		hc.Transport = o.configureTransport(hc.Transport)
+	}
+	return hc
+}
+
+// configureTransport applies proxy and TLS options to a copy of rt.
+// Transports other than *http.Transport are returned unchanged.
+func (o *clientOptions) configureTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok {
+		return rt
+	}
+	t = t.Clone()
+	if o.proxy != nil {
+		t.Proxy = o.proxy
+	}
+	if o.rootCAs != nil || len(o.certificates) > 0 {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		if o.rootCAs != nil {
+			t.TLSClientConfig.RootCAs = o.rootCAs
+		}
+		if len(o.certificates) > 0 {
+			t.TLSClientConfig.Certificates = o.certificates
+		}
+	}
+	return t
+}
+
+type ClientOption interface {
+	apply(*clientOptions)
+}
+
+// funcClientOption wraps a function that modifies clientOptions into an
+// implementation of the ClientOption interface.
+type funcClientOption struct {
+	f func(*clientOptions)
+}
+
+func (fco *funcClientOption) apply(do *clientOptions) {
+	fco.f(do)
+}
+
+func newFuncClientOption(f func(*clientOptions)) *funcClientOption {
+	return &funcClientOption{
+		f: f,
+	}
+}
+
+// WithEnvironment returns a ClientOption which sets base URL of predefined or custom Environment.
+func WithEnvironment(env Environment) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.baseURL = env.BaseURL
+	})
+}
+
+// WithBaseURL returns a ClientOption which sets base URL, e.g. "http://localhost:8000"
+// or "https://proxy.example.com/medsenger". Endpoint paths are joined to it.
+func WithBaseURL(baseURL string) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.baseURL = baseURL
+	})
+}
+
+// WithHost returns a ClientOption which sets Medsenger service hostname with optional port.
+// It overrides host of the base URL regardless of options order.
+func WithHost(host string) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.host = host
+	})
+}
+
+// WithScheme returns a ClientOption which sets Medsenger service URL scheme, "https" or "http".
+// It overrides scheme of the base URL regardless of options order.
+func WithScheme(scheme string) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.scheme = scheme
+	})
+}
+
+// WithStartupProbe returns a ClientOption which makes NewClient fetch categories
+// within timeout to check that Medsenger is reachable and accepts api key.
+func WithStartupProbe(timeout time.Duration) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.startupProbeTimeout = timeout
+	})
+}
+
+// WithHTTPClient returns a ClientOption which sets base *http.Client for requests.
+// The client is copied, so later options do not modify provided value.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.httpClient = hc
+	})
+}
+
+// WithTransport returns a ClientOption which sets http.RoundTripper used for requests.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.transport = rt
+	})
+}
+
+// WithTimeout returns a ClientOption which sets time limit for each request,
+// including reading of the response body.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.timeout = timeout
+	})
+}
+
+// WithProxy returns a ClientOption which sets proxy function, for example http.ProxyURL(u).
+// Applies only if transport is *http.Transport.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.proxy = proxy
+	})
+}
+
+// WithRootCAs returns a ClientOption which sets certificate authorities used to verify server.
+// Applies only if transport is *http.Transport.
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.rootCAs = pool
+	})
+}
+
+// WithClientCertificates returns a ClientOption which sets certificates presented
+// to the server for mutual TLS. Applies only if transport is *http.Transport.
+func WithClientCertificates(certs ...tls.Certificate) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.certificates = certs
+	})
+}
+
+// WithRetryPolicy returns a ClientOption which enables retries of failed requests.
+// By default requests are not retried. See DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.retryPolicy = policy
+	})
+}
+
+// WithRateLimit returns a ClientOption which limits all requests to rate per second
+// with bursts of at most burst requests. Requests over the limit wait until ctx is done.
+// rate must be positive and burst at least 1, otherwise NewClient returns *ConfigError.
+func WithRateLimit(rate float64, burst int) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.limits.rate = &rateLimit{rate: rate, burst: burst}
+	})
+}
+
+// WithMaxInFlight returns a ClientOption which limits number of concurrent requests.
+func WithMaxInFlight(n int) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.limits.maxInFlight = n
+	})
+}
+
+// WithGroupRateLimit is like WithRateLimit but applies only to requests of the group.
+// Group limit applies in addition to the global one.
+func WithGroupRateLimit(group EndpointGroup, rate float64, burst int) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		gl := o.groupLimit(group)
+		gl.rate = &rateLimit{rate: rate, burst: burst}
+		o.groupLimits[group] = gl
+	})
+}
+
+// WithGroupMaxInFlight is like WithMaxInFlight but applies only to requests of the group.
+func WithGroupMaxInFlight(group EndpointGroup, n int) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		gl := o.groupLimit(group)
+		gl.maxInFlight = n
+		o.groupLimits[group] = gl
+	})
+}
+
+// WithWaitObserver returns a ClientOption which reports time requests spent waiting for limits.
+func WithWaitObserver(observer WaitObserver) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.waitObserver = observer
+	})
+}
+
+// WithCircuitBreaker returns a ClientOption which enables circuit breaker for each endpoint.
+// After consecutive network errors or 5xx responses requests to the endpoint fail fast
+// with ErrCircuitOpen until timeout passes and trial request succeeds.
+func WithCircuitBreaker(settings CircuitBreakerSettings) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.breaker = &settings
+	})
+}
+
+// WithLogger returns a ClientOption which reports each HTTP request to logger.
+func WithLogger(logger Logger) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.logger = logger
+	})
+}
+
+// WithBodyLogging returns a ClientOption which adds request and response bodies to logs.
+// Api key, agent tokens and patient personal data are redacted.
+func WithBodyLogging() ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.logBodies = true
+	})
+}
+
+// WithTracer returns a ClientOption which starts span for each API call.
+func WithTracer(tracer Tracer) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.tracer = tracer
+	})
+}
+
+// WithMetrics returns a ClientOption which reports count and latency of HTTP requests.
+func WithMetrics(metrics Metrics) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.metrics = metrics
+	})
+}
+
+// WithMaxResponseSize returns a ClientOption which limits size of decompressed response body.
+// Larger responses fail with ErrResponseTooLarge.
+func WithMaxResponseSize(n int64) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.maxResponseSize = n
+	})
+}
+
+// WithCache returns a ClientOption which enables caching of categories, clinics and contract info.
+// Concurrent identical requests are coalesced into one.
+func WithCache(config CacheConfig) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.cache = &config
+	})
+}
+
+// WithOutbox returns a ClientOption which persists SendMessage, AddRecord, AddRecords and
+// SendRecordAddition requests to store when Medsenger is unavailable. Such calls return
+// error matching ErrQueued. Start Client.Outbox().Run to deliver them later.
+func WithOutbox(store OutboxStore, config OutboxConfig) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.outboxStore = store
+		o.outboxConfig = config
+	})
+}
+
+// WithIdempotencyStore returns a ClientOption which deduplicates write calls carrying
+// idempotency key (see ContextWithIdempotencyKey) within window, 24h if zero.
+// Results are scoped by api key Client had when created, so store can be shared between agents.
+func WithIdempotencyStore(store IdempotencyStore, window time.Duration) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.idempotencyStore = store
+		o.idempotencyWindow = window
+	})
+}
+
+// WithDryRun returns a ClientOption which intercepts write requests such as SendMessage,
+// AddRecords or OutDateMessage: they are validated, serialized and recorded to sink instead
+// of being sent, and callers receive synthetic negative ids. Read requests are sent as usual.
+func WithDryRun(sink DryRunSink) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.dryRunSink = sink
+	})
+}
+
+// WithFailover returns a ClientOption which adds backup base URLs. Requests that cannot
+// reach a host are sent to the next healthy one; see FailoverConfig.
+func WithFailover(config FailoverConfig) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.failover = &config
+	})
+}
+
+// WithKeyProvider returns a ClientOption which makes Client obtain api key from provider
+// before each request attempt instead of using key passed to NewClient.
+func WithKeyProvider(provider KeyProvider) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.keyProvider = provider
+	})
+}
+
+// WithUnauthorizedHook returns a ClientOption which calls hook when Medsenger rejects api key,
+// e.g. to reload FileKeyProvider or alert about leaked key.
+func WithUnauthorizedHook(hook func(ctx context.Context, err *APIError)) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.onUnauthorized = hook
+	})
+}
+
+// WithRecordBatching returns a ClientOption which coalesces concurrent AddRecord calls
+// of the same contract into single AddRecords request. Each caller gets its own record id;
+// if the request fails, all callers of the batch get the error. Records of callers that gave
+// up before the batch is sent are dropped.
+func WithRecordBatching(config RecordBatchConfig) ClientOption {
+	return newFuncClientOption(func(o *clientOptions) {
+		o.recordBatch = &config
+	})
+}
@@ -0,0 +1,62 @@
+package maigo
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+const testAPIKey = "0123456789abcdef"
+
+func TestNewClientRejectsInvalidLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  ClientOption
+	}{
+		{"zero rate", WithRateLimit(0, 1)},
+		{"negative rate", WithRateLimit(-1, 1)},
+		{"NaN rate", WithRateLimit(math.NaN(), 1)},
+		{"infinite rate", WithRateLimit(math.Inf(1), 1)},
+		{"zero burst", WithRateLimit(10, 0)},
+		{"zero group rate", WithGroupRateLimit(MessageEndpoints, 0, 1)},
+		{"negative max in flight", WithMaxInFlight(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(testAPIKey, tt.opt)
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("NewClient() error = %v, want *ConfigError", err)
+			}
+		})
+	}
+	if _, err := NewClient(testAPIKey, WithRateLimit(10, 1), WithGroupMaxInFlight(RecordEndpoints, 2)); err != nil {
+		t.Fatalf("NewClient() with valid limits error = %v", err)
+	}
+}
+
+func TestNewClientAPIKeyLength(t *testing.T) {
+	if _, err := NewClient("0123456789"); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("NewClient() with 10 characters key error = %v, want ErrInvalidConfig", err)
+	}
+	if _, err := NewClient("0123456789a"); err != nil {
+		t.Fatalf("NewClient() with 11 characters key error = %v", err)
+	}
+}
+
+func TestWithEnvironmentJoinsPathPrefix(t *testing.T) {
+	server := newTestServer(t, writeOK)
+	c, err := NewClient(testAPIKey, WithEnvironment(Staging(server.URL+"/staging")))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.GetContractInfo(1); err != nil {
+		t.Fatalf("GetContractInfo() error = %v", err)
+	}
+	if n := server.count("/staging" + contractInfoEndpoint.path); n != 1 {
+		t.Fatalf("server got %d requests under path prefix, want 1", n)
+	}
+	if _, ok := EnvironmentByName("staging"); ok {
+		t.Fatal("EnvironmentByName() found staging without base URL")
+	}
+}
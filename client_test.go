@@ -0,0 +1,137 @@
+package maigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const otherTestAPIKey = "fedcba9876543210"
+
+func TestWithOtherKeyDoesNotShareCache(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage) {
+		var apiKey string
+		_ = json.Unmarshal(body["api_key"], &apiKey)
+		_ = json.NewEncoder(w).Encode(map[string]string{"contract_number": apiKey})
+	})
+	a := newTestClient(t, server, WithCache(CacheConfig{ContractInfoTTL: 1 << 40}))
+	b, err := a.With(WithKeyProvider(StaticKey(otherTestAPIKey)))
+	if err != nil {
+		t.Fatalf("With() error = %v", err)
+	}
+	if _, err := a.GetContractInfo(1); err != nil {
+		t.Fatalf("GetContractInfo() error = %v", err)
+	}
+	info, err := b.GetContractInfo(1)
+	if err != nil {
+		t.Fatalf("GetContractInfo() error = %v", err)
+	}
+	if info.ContractNumber != otherTestAPIKey || server.count(contractInfoEndpoint.path) != 2 {
+		t.Fatalf("client with other key got cached %q", info.ContractNumber)
+	}
+	// Client with the same key shares cache.
+	same, err := a.With(WithRetryPolicy(DefaultRetryPolicy()))
+	if err != nil {
+		t.Fatalf("With() error = %v", err)
+	}
+	if _, err := same.GetContractInfo(1); err != nil || server.count(contractInfoEndpoint.path) != 2 {
+		t.Fatalf("client with same key did not use shared cache, err = %v", err)
+	}
+}
+
+func TestWithOtherKeyDoesNotShareIdempotencyResults(t *testing.T) {
+	server := newTestServer(t, writeOK)
+	store := NewMemoryIdempotencyStore()
+	a := newTestClient(t, server, WithIdempotencyStore(store, 0))
+	b, err := a.With(WithKeyProvider(StaticKey(otherTestAPIKey)))
+	if err != nil {
+		t.Fatalf("With() error = %v", err)
+	}
+	ctx := ContextWithIdempotencyKey(context.Background(), "key")
+	for _, c := range []*Client{a, b, a} {
+		if _, err := c.SendMessageContext(ctx, 1, "hello"); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+	}
+	if n := server.count(messageEndpoint.path); n != 2 {
+		t.Fatalf("server got %d messages, want 2", n)
+	}
+}
+
+func TestWithDoesNotModifyClient(t *testing.T) {
+	c, err := NewClient(testAPIKey)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	derived, err := c.With(WithHost("test.medsenger.ru"))
+	if err != nil {
+		t.Fatalf("With() error = %v", err)
+	}
+	if got := c.baseURL.String(); got != productionBaseURL {
+		t.Errorf("base URL of original Client = %s", got)
+	}
+	if got := derived.baseURL.String(); got != "https://test.medsenger.ru" {
+		t.Errorf("base URL of derived Client = %s", got)
+	}
+}
+
+func TestWithOtherHostDoesNotShareCircuitBreakers(t *testing.T) {
+	broken := newTestServer(t, func(w http.ResponseWriter, _ *http.Request, _ map[string]json.RawMessage) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	healthy := newTestServer(t, writeOK)
+	a := newTestClient(t, broken, WithCircuitBreaker(CircuitBreakerSettings{FailureThreshold: 1}))
+	b, err := a.With(WithBaseURL(healthy.URL))
+	if err != nil {
+		t.Fatalf("With() error = %v", err)
+	}
+	if _, err := a.GetContractInfo(1); err == nil {
+		t.Fatal("GetContractInfo() error = nil, want 503 error")
+	}
+	if state := a.CircuitState(contractInfoEndpoint.path); state != CircuitOpen {
+		t.Fatalf("CircuitState() = %v, want CircuitOpen", state)
+	}
+	if _, err := b.GetContractInfo(1); err != nil {
+		t.Fatalf("GetContractInfo() on other host error = %v", err)
+	}
+	if n := healthy.count(contractInfoEndpoint.path); n != 1 {
+		t.Fatalf("healthy host got %d requests, want 1", n)
+	}
+}
+
+func TestServeStaleOnlyWhenMedsengerIsUnavailable(t *testing.T) {
+	var status int32 = http.StatusOK
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage) {
+		switch atomic.LoadInt32(&status) {
+		case http.StatusOK:
+			writeOK(w, r, body)
+		case http.StatusNotFound:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"state":"error","error":"Contract not found"}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	c := newTestClient(t, server, WithCache(CacheConfig{ContractInfoTTL: time.Millisecond, ServeStale: true}))
+	if _, err := c.GetContractInfo(1); err != nil {
+		t.Fatalf("GetContractInfo() error = %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	if info, err := c.GetContractInfo(1); err != nil || info == nil {
+		t.Fatalf("GetContractInfo() = %v, %v, want stale value", info, err)
+	}
+	atomic.StoreInt32(&status, http.StatusNotFound)
+	if info, err := c.GetContractInfo(1); !errors.Is(err, ErrContractNotFound) {
+		t.Fatalf("GetContractInfo() = %v, %v, want ErrContractNotFound", info, err)
+	}
+	// Removed contract is evicted, so stale value is not served anymore.
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	if info, err := c.GetContractInfo(1); err == nil {
+		t.Fatalf("GetContractInfo() = %v, want error", info)
+	}
+}
@@ -0,0 +1,145 @@
+package maigo
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TikhonP/maigo/internal/api"
+	"github.com/TikhonP/maigo/internal/redact"
+)
+
+// DryRunCall is a write request intercepted in dry-run mode.
+type DryRunCall struct {
+	Time       time.Time       `json:"time"`
+	Endpoint   string          `json:"endpoint"`    // Request path, e.g. "/api/agents/message".
+	ContractId int             `json:"contract_id"` // Contract of the request.
+	Request    json.RawMessage `json:"request"`     // Request body with redacted api key.
+	Response   json.RawMessage `json:"response"`    // Synthetic response returned to the caller.
+}
+
+// DryRunSink receives intercepted write requests. Implementations must be safe for concurrent use.
+type DryRunSink interface {
+	Record(ctx context.Context, call DryRunCall) error
+}
+
+// DryRunRecorder keeps intercepted requests in memory.
+type DryRunRecorder struct {
+	mu    sync.Mutex
+	calls []DryRunCall
+}
+
+// NewDryRunRecorder creates empty DryRunRecorder.
+func NewDryRunRecorder() *DryRunRecorder {
+	return &DryRunRecorder{}
+}
+
+func (r *DryRunRecorder) Record(_ context.Context, call DryRunCall) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+	return nil
+}
+
+// Calls returns intercepted requests in order of calls.
+func (r *DryRunRecorder) Calls() []DryRunCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]DryRunCall(nil), r.calls...)
+}
+
+// WriterDryRunSink writes intercepted requests to io.Writer as newline delimited JSON.
+type WriterDryRunSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterDryRunSink creates WriterDryRunSink writing to w.
+func NewWriterDryRunSink(w io.Writer) *WriterDryRunSink {
+	return &WriterDryRunSink{w: w}
+}
+
+// NewFileDryRunSink creates WriterDryRunSink appending to file at path.
+// Close the returned file after the Client is not used anymore.
+func NewFileDryRunSink(path string) (*WriterDryRunSink, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewWriterDryRunSink(f), f, nil
+}
+
+func (s *WriterDryRunSink) Record(_ context.Context, call DryRunCall) error {
+	line, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// dryRun intercepts write requests.
+type dryRun struct {
+	sink   DryRunSink
+	lastId int64
+}
+
+// nextId returns synthetic identifier. Identifiers are negative, so they never match real ones.
+func (d *dryRun) nextId() int {
+	return -int(atomic.AddInt64(&d.lastId, 1))
+}
+
+// intercept records request to write ep and returns synthetic response.
+// It returns false if request must be sent.
+func (d *dryRun) intercept(ctx context.Context, ep endpoint, request any) (json.RawMessage, bool, error) {
+	if d == nil || !ep.write() {
+		return nil, false, nil
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, true, err
+	}
+	var response any
+	switch ep {
+	case messageEndpoint:
+		response = map[string]any{"state": "ok", "id": d.nextId()}
+	case addRecordsEndpoint:
+		var values struct {
+			Values []json.RawMessage `json:"values"`
+		}
+		if err := json.Unmarshal(body, &values); err != nil {
+			return nil, true, err
+		}
+		ids := make([]int, len(values.Values))
+		if len(ids) == 0 {
+			ids = make([]int, 1)
+		}
+		for i := range ids {
+			ids[i] = d.nextId()
+		}
+		response = ids
+	default:
+		response = map[string]any{"state": "ok"}
+	}
+	encodedResponse, err := json.Marshal(response)
+	if err != nil {
+		return nil, true, err
+	}
+	call := DryRunCall{
+		Time:       time.Now(),
+		Endpoint:   ep.path,
+		ContractId: api.ContractOf(request),
+		Request:    redact.JSON(body, map[string]bool{"api_key": true}),
+		Response:   encodedResponse,
+	}
+	if err := d.sink.Record(ctx, call); err != nil {
+		return nil, true, err
+	}
+	return encodedResponse, true, nil
+}
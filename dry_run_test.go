@@ -0,0 +1,55 @@
+package maigo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDryRunBypassesOutboxAndIdempotencyStore(t *testing.T) {
+	server := newTestServer(t, writeOK)
+	transport := &switchableTransport{}
+	base := newTestClient(t, server,
+		WithTransport(transport),
+		WithOutbox(NewMemoryOutboxStore(), OutboxConfig{}),
+		WithIdempotencyStore(NewMemoryIdempotencyStore(), 0),
+	)
+	ctx := context.Background()
+
+	transport.setDown(true)
+	if _, err := base.SendMessage(1, "queued"); !errors.Is(err, ErrQueued) {
+		t.Fatalf("SendMessage() error = %v, want ErrQueued", err)
+	}
+	transport.setDown(false)
+
+	recorder := NewDryRunRecorder()
+	dry, err := base.With(WithDryRun(recorder))
+	if err != nil {
+		t.Fatalf("With() error = %v", err)
+	}
+	keyCtx := ContextWithIdempotencyKey(ctx, "key-1")
+	if _, err := dry.SendMessageContext(ctx, 1, "dry"); err != nil {
+		t.Fatalf("dry-run SendMessage() error = %v", err)
+	}
+	dryId, err := dry.SendMessageContext(keyCtx, 2, "dry with key")
+	if err != nil {
+		t.Fatalf("dry-run SendMessage() error = %v", err)
+	}
+	if n := len(recorder.Calls()); n != 2 {
+		t.Fatalf("recorder got %d calls, want 2", n)
+	}
+
+	if err := base.Outbox().Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if n := server.count(messageEndpoint.path); n != 1 {
+		t.Fatalf("server got %d messages after flush, want 1", n)
+	}
+	realId, err := base.SendMessageContext(keyCtx, 2, "real with key")
+	if err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if realId == dryId || server.count(messageEndpoint.path) != 2 {
+		t.Fatalf("real call returned dry-run id %d without request", realId)
+	}
+}
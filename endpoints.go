@@ -0,0 +1,41 @@
+package maigo
+
+// EndpointGroup groups Medsenger API methods with similar load for rate limiting.
+type EndpointGroup string
+
+const (
+	ReadEndpoints    EndpointGroup = "read"     // Methods fetching data, e.g. GetRecords.
+	MessageEndpoints EndpointGroup = "messages" // Methods changing chat, e.g. SendMessage.
+	RecordEndpoints  EndpointGroup = "records"  // Methods changing medical records, e.g. AddRecords.
+	OrderEndpoints   EndpointGroup = "orders"   // Methods sending orders to other agents.
+)
+
+// endpoint describes Medsenger API method.
+type endpoint struct {
+	path       string        // Request path, e.g. "/api/agents/message".
+	group      EndpointGroup // Group used for rate limiting.
+	idempotent bool          // Request can be repeated without side effects.
+	personal   bool          // Response contains patient personal data.
+}
+
+var (
+	contractInfoEndpoint        = endpoint{path: "/api/agents/patient/info", group: ReadEndpoints, idempotent: true, personal: true}
+	clinicsEndpoint             = endpoint{path: "/api/agents/clinics", group: ReadEndpoints, idempotent: true}
+	messageEndpoint             = endpoint{path: "/api/agents/message", group: MessageEndpoints}
+	outdateMessageEndpoint      = endpoint{path: "/api/agents/message/outdate", group: MessageEndpoints, idempotent: true}
+	categoriesEndpoint          = endpoint{path: "/api/agents/records/categories", group: ReadEndpoints, idempotent: true}
+	availableCategoriesEndpoint = endpoint{path: "/api/agents/records/available_categories", group: ReadEndpoints, idempotent: true}
+	recordsEndpoint             = endpoint{path: "/api/agents/records/get/all", group: ReadEndpoints, idempotent: true}
+	recordEndpoint              = endpoint{path: "/api/agents/records/get", group: ReadEndpoints, idempotent: true}
+	recordAdditionEndpoint      = endpoint{path: "/api/agents/records/addition", group: RecordEndpoints}
+	agentTokenEndpoint          = endpoint{path: "/api/agents/token", group: ReadEndpoints, idempotent: true}
+	addRecordsEndpoint          = endpoint{path: "/api/agents/records/add", group: RecordEndpoints}
+	addHooksEndpoint            = endpoint{path: "/api/agents/hooks/add", group: RecordEndpoints, idempotent: true}
+	removeHooksEndpoint         = endpoint{path: "/api/agents/hooks/remove", group: RecordEndpoints, idempotent: true}
+	orderEndpoint               = endpoint{path: "/api/agents/order", group: OrderEndpoints}
+)
+
+// write reports whether ep changes Medsenger data.
+func (ep endpoint) write() bool {
+	return ep.group != ReadEndpoints
+}
@@ -0,0 +1,42 @@
+package maigo
+
+// Environment is a named Medsenger deployment the Client talks to.
+//
+// Production and Local are predefined. Staging deployments have no common address,
+// so staging profile is created with Staging from the base URL of the deployment.
+// Other deployments can be described with Environment literal or WithBaseURL.
+type Environment struct {
+	Name    string // Profile name, e.g. "production".
+	BaseURL string // Base URL that endpoint paths are joined to, may include path prefix.
+}
+
+const (
+	productionBaseURL = "https://medsenger.ru"
+	localBaseURL      = "http://localhost:8000"
+)
+
+// Production returns environment of public Medsenger deployment. It is used by default.
+func Production() Environment {
+	return Environment{Name: "production", BaseURL: productionBaseURL}
+}
+
+// Local returns environment of Medsenger running on developer machine.
+func Local() Environment {
+	return Environment{Name: "local", BaseURL: localBaseURL}
+}
+
+// Staging returns staging environment with baseURL, e.g. "https://medsenger.example.com/staging".
+func Staging(baseURL string) Environment {
+	return Environment{Name: "staging", BaseURL: baseURL}
+}
+
+// EnvironmentByName returns predefined environment with name, e.g. read from configuration.
+// Staging is not predefined, because its base URL is specific to deployment; use Staging.
+func EnvironmentByName(name string) (Environment, bool) {
+	for _, env := range []Environment{Production(), Local()} {
+		if env.Name == name {
+			return env, true
+		}
+	}
+	return Environment{}, false
+}
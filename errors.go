@@ -0,0 +1,138 @@
+package maigo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/TikhonP/maigo/internal/net"
+)
+
+// Sentinel errors that APIError matches with errors.Is.
+var (
+	ErrUnauthorized     = errors.New("maigo: unauthorized api key")
+	ErrContractNotFound = errors.New("maigo: contract not found")
+	ErrUnknownCategory  = errors.New("maigo: unknown category")
+	ErrValidation       = errors.New("maigo: validation failed")
+	ErrEmptyResponse    = errors.New("maigo: empty response")
+)
+
+// ErrResponseTooLarge is returned when response body exceeds limit set with WithMaxResponseSize.
+var ErrResponseTooLarge = net.ErrResponseTooLarge
+
+// APIError describes request rejected by Medsenger.
+//
+// Use errors.Is with ErrUnauthorized, ErrContractNotFound, ErrUnknownCategory,
+// ErrValidation or ErrEmptyResponse to check the reason. Responses with 5xx status
+// never match them, because they mean that Medsenger failed, not that request is wrong.
+type APIError struct {
+	Endpoint   string // Request path, e.g. "/api/agents/message".
+	StatusCode int    // HTTP status code.
+	State      string // Value of "state" field of the response body.
+	Message    string // Error message of the response body.
+
+	kind  error // One of sentinel errors or nil.
+	cause error // Error of the HTTP layer.
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("maigo: %s: %d %s", e.Endpoint, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.State != "" {
+		msg += ", state: " + e.State
+	}
+	if e.Message != "" {
+		msg += ", message: " + e.Message
+	}
+	return msg
+}
+
+// Is reports whether target is sentinel error describing e.
+func (e *APIError) Is(target error) bool {
+	return e.kind != nil && e.kind == target
+}
+
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+// errorResponse is a body Medsenger sends with failed requests.
+type errorResponse struct {
+	State   string `json:"state"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// newAPIError converts *net.StatusError to *APIError. Other errors are returned unchanged.
+func newAPIError(endpoint string, err error) error {
+	var statusErr *net.StatusError
+	if !errors.As(err, &statusErr) {
+		return err
+	}
+	apiErr := &APIError{Endpoint: endpoint, StatusCode: statusErr.StatusCode, cause: err}
+	var body errorResponse
+	if json.Unmarshal(statusErr.Body, &body) == nil {
+		apiErr.State = body.State
+		apiErr.Message = body.Error
+		if apiErr.Message == "" {
+			apiErr.Message = body.Message
+		}
+	} else {
+		apiErr.Message = strings.TrimSpace(string(statusErr.Body))
+	}
+	apiErr.kind = classifyAPIError(apiErr)
+	return apiErr
+}
+
+// classifyAPIError matches e against sentinel errors using status code and message.
+// Only 4xx responses are classified, so failure of Medsenger is never reported as bad input.
+func classifyAPIError(e *APIError) error {
+	if e.StatusCode < http.StatusBadRequest || e.StatusCode >= http.StatusInternalServerError {
+		return nil
+	}
+	msg := strings.ToLower(e.State + " " + e.Message)
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden,
+		strings.Contains(msg, "api_key"), strings.Contains(msg, "incorrect token"):
+		return ErrUnauthorized
+	case strings.Contains(msg, "category"):
+		return ErrUnknownCategory
+	case strings.Contains(msg, "contract") && (e.StatusCode == http.StatusNotFound || strings.Contains(msg, "not found")):
+		return ErrContractNotFound
+	case e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity:
+		return ErrValidation
+	}
+	return nil
+}
+
+// ErrInvalidConfig is matched by *ConfigError with errors.Is.
+var ErrInvalidConfig = errors.New("maigo: invalid client configuration")
+
+// ConfigProblem describes invalid Client configuration field.
+type ConfigProblem struct {
+	Field  string // Configuration field, e.g. "apiKey" or "host".
+	Reason string // Human readable description of the problem.
+}
+
+// ConfigError is returned by NewClient when configuration is invalid.
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) add(field, reason string) {
+	e.Problems = append(e.Problems, ConfigProblem{Field: field, Reason: reason})
+}
+
+func (e *ConfigError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		problems[i] = p.Field + " " + p.Reason
+	}
+	return "maigo: invalid client configuration: " + strings.Join(problems, "; ")
+}
+
+// Is reports whether target is ErrInvalidConfig.
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
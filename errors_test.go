@@ -0,0 +1,42 @@
+package maigo
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/TikhonP/maigo/internal/net"
+)
+
+func TestNewAPIErrorClassification(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"unauthorized status", http.StatusUnauthorized, `{"state":"error"}`, ErrUnauthorized},
+		{"incorrect api key", http.StatusBadRequest, `{"state":"error","error":"Incorrect api_key"}`, ErrUnauthorized},
+		{"contract not found", http.StatusNotFound, `{"state":"error","error":"Contract not found"}`, ErrContractNotFound},
+		{"bare proxy 404", http.StatusNotFound, `<html><body>404 Not Found</body></html>`, nil},
+		{"unknown category", http.StatusBadRequest, `{"state":"error","error":"Unknown category"}`, ErrUnknownCategory},
+		{"validation", http.StatusUnprocessableEntity, `{"state":"error","error":"bad value"}`, ErrValidation},
+		{"server error mentioning category", http.StatusInternalServerError, `{"state":"error","error":"failed to load category list"}`, nil},
+		{"server error mentioning contract", http.StatusServiceUnavailable, `{"state":"error","error":"contract not found"}`, nil},
+	}
+	sentinels := []error{ErrUnauthorized, ErrContractNotFound, ErrUnknownCategory, ErrValidation}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newAPIError("/api/agents/records/get", &net.StatusError{StatusCode: tt.status, Body: []byte(tt.body)})
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("newAPIError() = %T, want *APIError", err)
+			}
+			for _, sentinel := range sentinels {
+				if got := errors.Is(err, sentinel); got != (sentinel == tt.want) {
+					t.Errorf("errors.Is(err, %v) = %v", sentinel, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package maigo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/TikhonP/maigo/internal/api"
+	"github.com/TikhonP/maigo/internal/net"
+)
+
+// FailoverConfig configures failover between the primary base URL and backup ones.
+//
+// Host is marked unhealthy after connection error or 5xx response and is skipped
+// until periodic probe succeeds. Probe is GetCategories request sent to the host. Reading requests are repeated on the next host after
+// any such failure. Writing requests, e.g. SendMessage, are repeated on the next host only
+// when connection was not established, so failover never duplicates messages or records.
+type FailoverConfig struct {
+	BaseURLs        []string      // Backup base URLs tried after the primary one in order.
+	ReprobeInterval time.Duration // Interval between probes of unhealthy host, 30s if not set.
+	ProbeTimeout    time.Duration // Time limit of a probe, 5s if not set.
+
+	// OnActiveHostChange is called with base URLs when the first healthy host changes.
+	// Calls are never concurrent and arrive in order of changes. It is called from
+	// goroutines performing requests, so it must not block.
+	OnActiveHostChange func(from, to string)
+}
+
+type hostState struct {
+	baseURL   *url.URL
+	healthy   bool
+	probedAt  time.Time // Time of the last failure or probe.
+	isProbing bool
+}
+
+type hostChange struct {
+	from, to string
+}
+
+// hostPool tracks health of hosts in priority order.
+type hostPool struct {
+	config FailoverConfig
+	check  func(ctx context.Context, baseURL *url.URL) error // Sends probe request to host.
+
+	mu        sync.Mutex
+	hosts     []*hostState
+	active    *hostState
+	changes   []hostChange // Active host changes not reported yet.
+	notifying bool         // Some goroutine reports changes.
+}
+
+func newHostPool(primary *url.URL, backups []*url.URL, config FailoverConfig, check func(ctx context.Context, baseURL *url.URL) error) *hostPool {
+	if config.ReprobeInterval <= 0 {
+		config.ReprobeInterval = 30 * time.Second
+	}
+	if config.ProbeTimeout <= 0 {
+		config.ProbeTimeout = 5 * time.Second
+	}
+	p := &hostPool{config: config, check: check}
+	for _, u := range append([]*url.URL{primary}, backups...) {
+		p.hosts = append(p.hosts, &hostState{baseURL: u, healthy: true})
+	}
+	p.active = p.hosts[0]
+	return p
+}
+
+// candidates returns hosts to try in order: healthy ones first, then unhealthy ones,
+// so requests are still attempted when all hosts failed. Due probes are started.
+func (p *hostPool) candidates() []*hostState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	healthy := make([]*hostState, 0, len(p.hosts))
+	var unhealthy []*hostState
+	for _, h := range p.hosts {
+		if h.healthy {
+			healthy = append(healthy, h)
+			continue
+		}
+		unhealthy = append(unhealthy, h)
+		if !h.isProbing && time.Since(h.probedAt) >= p.config.ReprobeInterval {
+			h.isProbing = true
+			go p.probe(h)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// probe checks unhealthy host with API request, so host serving other pages while API
+// fails stays unhealthy. Any response other than 5xx means that API is reachable.
+func (p *hostPool) probe(h *hostState) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.ProbeTimeout)
+	defer cancel()
+	err := p.check(ctx, h.baseURL)
+	healthy := err == nil || (!isHostFailure(err) && ctx.Err() == nil)
+	p.mu.Lock()
+	h.isProbing = false
+	h.probedAt = time.Now()
+	p.mu.Unlock()
+	p.setHealthy(h, healthy)
+}
+
+// setHealthy updates host health and reports change of the active host.
+func (p *hostPool) setHealthy(h *hostState, healthy bool) {
+	p.mu.Lock()
+	if !healthy && h.healthy {
+		h.probedAt = time.Now()
+	}
+	h.healthy = healthy
+	from := p.active
+	p.active = p.hosts[0]
+	for _, host := range p.hosts {
+		if host.healthy {
+			p.active = host
+			break
+		}
+	}
+	to := p.active
+	if from != to && p.config.OnActiveHostChange != nil {
+		p.changes = append(p.changes, hostChange{from: from.baseURL.String(), to: to.baseURL.String()})
+	}
+	p.mu.Unlock()
+	p.notify()
+}
+
+// notify reports active host changes in order. Only one goroutine reports changes at a time,
+// others leave their changes to it, so OnActiveHostChange is never called concurrently.
+func (p *hostPool) notify() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.notifying {
+		return
+	}
+	p.notifying = true
+	for len(p.changes) > 0 {
+		change := p.changes[0]
+		p.changes = p.changes[1:]
+		p.mu.Unlock()
+		p.config.OnActiveHostChange(change.from, change.to)
+		p.mu.Lock()
+	}
+	p.notifying = false
+}
+
+// checkHost sends GetCategories request to host at baseURL. It is cheap and has no side effects.
+func (c *Client) checkHost(ctx context.Context, baseURL *url.URL) error {
+	request := api.TokenOnlyRequest{}
+	if err := c.setApiKey(ctx, &request); err != nil {
+		return err
+	}
+	u := *baseURL
+	u.Path += categoriesEndpoint.path
+	cfg := net.Config{Client: c.httpClient, URL: &u, MaxResponseSize: c.maxResponseSize}
+	return net.MakeRequestWithEmptyResponse(ctx, cfg, request)
+}
+
+// ActiveBaseURL returns base URL of the host requests are sent to first.
+func (c *Client) ActiveBaseURL() string {
+	if c.hosts == nil {
+		return c.baseURL.String()
+	}
+	c.hosts.mu.Lock()
+	defer c.hosts.mu.Unlock()
+	return c.hosts.active.baseURL.String()
+}
+
+// isHostFailure reports whether err means that host is unreachable or broken.
+func isHostFailure(err error) bool {
+	var statusErr *net.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	return isServerFailure(err)
+}
+
+// attemptHosts performs attempt on healthy hosts until it succeeds or fails
+// with error that does not allow sending request to another host.
+func (c *Client) attemptHosts(ctx context.Context, ep endpoint, cfg net.Config, attempt func(ctx context.Context, cfg net.Config) error) (int, error) {
+	if c.hosts == nil {
+		cfg.URL = c.urlAppendingPath(ep.path)
+		return c.observeAttempt(ctx, ep, cfg, attempt)
+	}
+	var (
+		statusCode int
+		err        error
+	)
+	for _, h := range c.hosts.candidates() {
+		u := *h.baseURL
+		u.Path += ep.path
+		cfg.URL = &u
+		statusCode, err = c.observeAttempt(ctx, ep, cfg, attempt)
+		if err == nil || !isHostFailure(err) {
+			c.hosts.setHealthy(h, true)
+			return statusCode, err
+		}
+		if ctx.Err() != nil {
+			return statusCode, err
+		}
+		c.hosts.setHealthy(h, false)
+		if !net.Retryable(err, ep.idempotent) {
+			return statusCode, err
+		}
+	}
+	return statusCode, err
+}
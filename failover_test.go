@@ -0,0 +1,180 @@
+package maigo
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func serviceUnavailable(w http.ResponseWriter, _ *http.Request, _ map[string]json.RawMessage) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func TestFailoverReadsFromBackupAfter5xx(t *testing.T) {
+	primary := newTestServer(t, serviceUnavailable)
+	backup := newTestServer(t, writeOK)
+	var (
+		mu      sync.Mutex
+		changes [][2]string
+	)
+	c := newTestClient(t, primary, WithFailover(FailoverConfig{
+		BaseURLs: []string{backup.URL},
+		OnActiveHostChange: func(from, to string) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, [2]string{from, to})
+		},
+	}))
+
+	if _, err := c.GetContractInfo(1); err != nil {
+		t.Fatalf("GetContractInfo() error = %v", err)
+	}
+	if n := backup.count(contractInfoEndpoint.path); n != 1 {
+		t.Fatalf("backup got %d requests, want 1", n)
+	}
+	if got := c.ActiveBaseURL(); got != backup.URL {
+		t.Fatalf("ActiveBaseURL() = %q, want %q", got, backup.URL)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != 1 || changes[0] != [2]string{primary.URL, backup.URL} {
+		t.Fatalf("OnActiveHostChange calls = %v, want [[%s %s]]", changes, primary.URL, backup.URL)
+	}
+
+	// Unhealthy primary is skipped until it is probed again.
+	if _, err := c.GetContractInfo(1); err != nil {
+		t.Fatalf("GetContractInfo() error = %v", err)
+	}
+	if n := primary.count(contractInfoEndpoint.path); n != 1 {
+		t.Fatalf("primary got %d requests, want 1", n)
+	}
+}
+
+func TestFailoverDoesNotRepeatWriteAfter5xx(t *testing.T) {
+	primary := newTestServer(t, serviceUnavailable)
+	backup := newTestServer(t, writeOK)
+	c := newTestClient(t, primary, WithFailover(FailoverConfig{BaseURLs: []string{backup.URL}}))
+
+	if _, err := c.SendMessage(1, "text"); err == nil {
+		t.Fatal("SendMessage() error = nil, want 503 error")
+	}
+	if n := backup.count(messageEndpoint.path); n != 0 {
+		t.Fatalf("backup got %d messages, want 0", n)
+	}
+}
+
+func TestFailoverSendsWriteToBackupWhenPrimaryIsUnreachable(t *testing.T) {
+	primary := newTestServer(t, writeOK)
+	primary.Close() // Connections are refused, so message never reaches primary.
+	backup := newTestServer(t, writeOK)
+	c := newTestClient(t, primary, WithFailover(FailoverConfig{BaseURLs: []string{backup.URL}}))
+
+	if _, err := c.SendMessage(1, "text"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if n := backup.count(messageEndpoint.path); n != 1 {
+		t.Fatalf("backup got %d messages, want 1", n)
+	}
+}
+
+func TestFailoverProbesAPIPath(t *testing.T) {
+	var down int32 = 1
+	primary := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage) {
+		// Ingress answers its own pages while API is down.
+		if atomic.LoadInt32(&down) == 1 && r.URL.Path != "/" {
+			serviceUnavailable(w, r, body)
+			return
+		}
+		writeOK(w, r, body)
+	})
+	backup := newTestServer(t, writeOK)
+	changes := make(chan [2]string, 10)
+	c := newTestClient(t, primary, WithFailover(FailoverConfig{
+		BaseURLs:        []string{backup.URL},
+		ReprobeInterval: time.Millisecond,
+		OnActiveHostChange: func(from, to string) {
+			changes <- [2]string{from, to}
+		},
+	}))
+	if _, err := c.GetContractInfo(1); err != nil {
+		t.Fatalf("GetContractInfo() error = %v", err)
+	}
+	if change := <-changes; change != [2]string{primary.URL, backup.URL} {
+		t.Fatalf("OnActiveHostChange(%q, %q), want switch to backup", change[0], change[1])
+	}
+
+	waitForProbe := func() {
+		t.Helper()
+		n := primary.count(categoriesEndpoint.path)
+		deadline := time.Now().Add(time.Second)
+		for primary.count(categoriesEndpoint.path) == n {
+			if time.Now().After(deadline) {
+				t.Fatal("primary was not probed")
+			}
+			time.Sleep(2 * time.Millisecond)
+			_, _ = c.GetContractInfo(1) // Starts due probes.
+		}
+		time.Sleep(10 * time.Millisecond) // Let probe finish.
+	}
+	waitForProbe()
+	if got := c.ActiveBaseURL(); got != backup.URL {
+		t.Fatalf("ActiveBaseURL() = %q after probe of failing API, want backup", got)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("OnActiveHostChange was called %d more times", len(changes))
+	}
+
+	atomic.StoreInt32(&down, 0)
+	waitForProbe()
+	if change := <-changes; change != [2]string{backup.URL, primary.URL} {
+		t.Fatalf("OnActiveHostChange(%q, %q), want switch back to primary", change[0], change[1])
+	}
+}
+
+func TestOnActiveHostChangeIsNotConcurrent(t *testing.T) {
+	primary := newTestServer(t, writeOK)
+	backup := newTestServer(t, writeOK)
+	var (
+		mu           sync.Mutex
+		inCallback   int32
+		overlapped   bool
+		lastActive   = primary.URL
+		outOfOrder   bool
+		changesCount int
+	)
+	config := FailoverConfig{
+		BaseURLs: []string{backup.URL},
+		OnActiveHostChange: func(from, to string) {
+			concurrent := atomic.AddInt32(&inCallback, 1) > 1
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			overlapped = overlapped || concurrent
+			if from != lastActive {
+				outOfOrder = true
+			}
+			lastActive = to
+			changesCount++
+			mu.Unlock()
+			atomic.AddInt32(&inCallback, -1)
+		},
+	}
+	c := newTestClient(t, primary, WithFailover(config))
+	first := c.hosts.hosts[0]
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.hosts.setHealthy(first, i%2 == 1)
+		}(i)
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if overlapped || outOfOrder || changesCount == 0 {
+		t.Fatalf("callbacks overlapped = %v, out of order = %v, calls = %d", overlapped, outOfOrder, changesCount)
+	}
+}
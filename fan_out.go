@@ -0,0 +1,148 @@
+package maigo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// FanOutResult is result of operation for one contract.
+type FanOutResult[T any] struct {
+	Value T
+	Err   error // Error of operation or ctx error if operation was not started.
+}
+
+// FanOutProgress is called after operation for contractId finishes.
+// done is the number of finished operations out of total.
+type FanOutProgress func(contractId int, err error, done, total int)
+
+type fanOutOptions struct {
+	concurrency int
+	itemTimeout time.Duration
+	stopOnError bool
+	progress    FanOutProgress
+}
+
+type FanOutOption interface {
+	apply(*fanOutOptions)
+}
+
+// funcFanOutOption wraps a function that modifies fanOutOptions into an
+// implementation of the FanOutOption interface.
+type funcFanOutOption struct {
+	f func(*fanOutOptions)
+}
+
+func (ffo *funcFanOutOption) apply(do *fanOutOptions) {
+	ffo.f(do)
+}
+
+func newFuncFanOutOption(f func(*fanOutOptions)) *funcFanOutOption {
+	return &funcFanOutOption{
+		f: f,
+	}
+}
+
+// FanOutConcurrency limits number of concurrently running operations, 8 by default.
+func FanOutConcurrency(n int) FanOutOption {
+	return newFuncFanOutOption(func(o *fanOutOptions) {
+		o.concurrency = n
+	})
+}
+
+// FanOutItemTimeout limits time of each operation.
+func FanOutItemTimeout(timeout time.Duration) FanOutOption {
+	return newFuncFanOutOption(func(o *fanOutOptions) {
+		o.itemTimeout = timeout
+	})
+}
+
+// FanOutStopOnError cancels running operations and skips remaining ones after the first error.
+func FanOutStopOnError() FanOutOption {
+	return newFuncFanOutOption(func(o *fanOutOptions) {
+		o.stopOnError = true
+	})
+}
+
+// FanOutWithProgress sets progress callback. It is called sequentially.
+func FanOutWithProgress(progress FanOutProgress) FanOutOption {
+	return newFuncFanOutOption(func(o *fanOutOptions) {
+		o.progress = progress
+	})
+}
+
+// FanOut runs op with c for each contract id with bounded concurrency and returns results by contract id.
+// Duplicate ids are run once. The returned error is the first operation error if FanOutStopOnError
+// is set, or ctx error if ctx is done before all operations are finished; results are returned anyway.
+//
+//	infos, err := maigo.FanOut(ctx, client, contractIds, func(ctx context.Context, c *maigo.Client, id int) (*maigo.ContractInfo, error) {
+//		return c.GetContractInfoContext(ctx, id)
+//	}, maigo.FanOutConcurrency(16))
+func FanOut[T any](ctx context.Context, c *Client, contractIds []int, op func(ctx context.Context, c *Client, contractId int) (T, error), opts ...FanOutOption) (map[int]FanOutResult[T], error) {
+	o := &fanOutOptions{concurrency: 8}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	if o.concurrency <= 0 {
+		o.concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(map[int]FanOutResult[T], len(contractIds))
+	ids := make([]int, 0, len(contractIds))
+	for _, id := range contractIds {
+		if _, ok := results[id]; !ok {
+			results[id] = FanOutResult[T]{}
+			ids = append(ids, id)
+		}
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		done     int
+		firstErr error
+		slots    = make(chan struct{}, o.concurrency)
+	)
+	finish := func(id int, result FanOutResult[T]) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[id] = result
+		done++
+		if result.Err != nil && o.stopOnError && firstErr == nil {
+			firstErr = result.Err
+			cancel()
+		}
+		if o.progress != nil {
+			o.progress(id, result.Err, done, len(ids))
+		}
+	}
+	for _, id := range ids {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			finish(id, FanOutResult[T]{Err: ctx.Err()})
+			continue
+		}
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			itemCtx := ctx
+			if o.itemTimeout > 0 {
+				var cancelItem context.CancelFunc
+				itemCtx, cancelItem = context.WithTimeout(ctx, o.itemTimeout)
+				defer cancelItem()
+			}
+			value, err := op(itemCtx, c, id)
+			finish(id, FanOutResult[T]{Value: value, Err: err})
+		}(id)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return results, firstErr
+	}
+	return results, ctx.Err()
+}
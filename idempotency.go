@@ -0,0 +1,297 @@
+package maigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type idempotencyKeyContextKey struct{}
+
+// ContextWithIdempotencyKey returns ctx carrying idempotency key for SendMessageContext,
+// AddRecordContext and AddRecordsContext. Repeated call with the same key and contract
+// within deduplication window returns ids of the original call instead of creating duplicates.
+// If the original call was queued in the outbox, repeated call returns *QueuedError with
+// the same entry until the entry is delivered.
+//
+// Deduplication requires WithIdempotencyStore; to deduplicate calls repeated after
+// process restart the store must be durable, e.g. FileIdempotencyStore. Records also get the key as
+// "external_id" in params, so duplicates can be detected in Medsenger data.
+func ContextWithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey{}, key)
+}
+
+// IdempotencyKeyFromContext returns idempotency key set with ContextWithIdempotencyKey.
+func IdempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyContextKey{}).(string)
+	return key, ok && key != ""
+}
+
+// IdempotencyStore keeps results of write calls by idempotency key.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Get returns ids saved for key if they did not expire.
+	Get(ctx context.Context, key string) (ids []int, ok bool, err error)
+	// Put saves ids for key for ttl.
+	Put(ctx context.Context, key string, ids []int, ttl time.Duration) error
+}
+
+type idempotencyEntry struct {
+	ids     []int
+	expires time.Time
+}
+
+// MemoryIdempotencyStore keeps idempotency keys in memory. Keys are lost when process exits,
+// so calls repeated after restart are not deduplicated; use FileIdempotencyStore or own store for that.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+}
+
+// NewMemoryIdempotencyStore creates empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]idempotencyEntry)}
+}
+
+func (s *MemoryIdempotencyStore) Get(_ context.Context, key string) ([]int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(e.expires) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	return append([]int(nil), e.ids...), true, nil
+}
+
+func (s *MemoryIdempotencyStore) Put(_ context.Context, key string, ids []int, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = idempotencyEntry{ids: append([]int(nil), ids...), expires: now.Add(ttl)}
+	return nil
+}
+
+// FileIdempotencyStore keeps idempotency keys in JSON file, so calls repeated
+// after process restart are deduplicated too. It is safe for concurrent use
+// inside one process; the file must not be shared between processes.
+type FileIdempotencyStore struct {
+	path string
+	mu   sync.Mutex // Serializes writes.
+	mem  MemoryIdempotencyStore
+}
+
+type fileIdempotencyEntry struct {
+	Ids     []int     `json:"ids"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewFileIdempotencyStore opens FileIdempotencyStore at path, loading keys that did not expire.
+func NewFileIdempotencyStore(path string) (*FileIdempotencyStore, error) {
+	s := &FileIdempotencyStore{path: path, mem: MemoryIdempotencyStore{entries: make(map[string]idempotencyEntry)}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string]fileIdempotencyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("maigo: idempotency file %s: %w", path, err)
+	}
+	now := time.Now()
+	for key, e := range entries {
+		if now.Before(e.Expires) {
+			s.mem.entries[key] = idempotencyEntry{ids: e.Ids, expires: e.Expires}
+		}
+	}
+	return s, nil
+}
+
+func (s *FileIdempotencyStore) Get(ctx context.Context, key string) ([]int, bool, error) {
+	return s.mem.Get(ctx, key)
+}
+
+// Put saves ids for key and writes all keys to file.
+func (s *FileIdempotencyStore) Put(ctx context.Context, key string, ids []int, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.mem.Put(ctx, key, ids, ttl); err != nil {
+		return err
+	}
+	s.mem.mu.Lock()
+	entries := make(map[string]fileIdempotencyEntry, len(s.mem.entries))
+	for k, e := range s.mem.entries {
+		entries[k] = fileIdempotencyEntry{Ids: e.ids, Expires: e.expires}
+	}
+	s.mem.mu.Unlock()
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// deduplicator runs write calls at most once per idempotency key.
+type deduplicator struct {
+	store  IdempotencyStore
+	window time.Duration
+	scope  string // Fingerprint of api key prefixing store keys.
+
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newDeduplicator(store IdempotencyStore, window time.Duration, scope string) *deduplicator {
+	if store == nil {
+		return nil
+	}
+	if window <= 0 {
+		window = 24 * time.Hour
+	}
+	return &deduplicator{store: store, window: window, scope: scope, locks: make(map[string]*keyLock)}
+}
+
+// lock serializes calls with the same key inside the process.
+func (d *deduplicator) lock(key string) (unlock func()) {
+	d.mu.Lock()
+	l, ok := d.locks[key]
+	if !ok {
+		l = &keyLock{}
+		d.locks[key] = l
+	}
+	l.refs++
+	d.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(d.locks, key)
+		}
+	}
+}
+
+type idempotencyStoreKeyContextKey struct{}
+
+// deduplicate calls write unless call of method with the same idempotency key of ctx already succeeded.
+// Results are stored separately per method, because methods return different ids.
+// Failure to save result does not fail the call, because write already succeeded.
+//
+// Call queued in the outbox is saved without ids, so repeated calls return *QueuedError
+// instead of queuing request again. Outbox saves ids of the call after delivery.
+func (c *Client) deduplicate(ctx context.Context, method string, contractId int, write func(ctx context.Context) ([]int, error)) ([]int, error) {
+	key, ok := IdempotencyKeyFromContext(ctx)
+	if !ok || c.dedup == nil || c.dryRun != nil {
+		// Synthetic ids of dry-run calls must not be returned to real calls with the same key.
+		return write(ctx)
+	}
+	storeKey := fmt.Sprintf("%s:%s:%d:%s", c.dedup.scope, method, contractId, key)
+	unlock := c.dedup.lock(storeKey)
+	defer unlock()
+	ids, found, err := c.dedup.store.Get(ctx, storeKey)
+	if err != nil {
+		return nil, fmt.Errorf("maigo: idempotency store: %w", err)
+	}
+	if found && len(ids) > 0 {
+		return ids, nil
+	}
+	if found {
+		entry, queued, err := c.outbox.entryWithIdempotencyKey(ctx, storeKey)
+		if err != nil {
+			return nil, fmt.Errorf("maigo: outbox: %w", err)
+		}
+		if queued {
+			return nil, &QueuedError{EntryId: entry.Id}
+		}
+		// Entry was removed from the outbox without delivery, so the call is made again.
+	}
+	ids, err = write(context.WithValue(ctx, idempotencyStoreKeyContextKey{}, storeKey))
+	var queuedErr *QueuedError
+	if errors.As(err, &queuedErr) {
+		_ = c.dedup.store.Put(ctx, storeKey, nil, c.dedup.window)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = c.dedup.store.Put(ctx, storeKey, ids, c.dedup.window)
+	return ids, nil
+}
+
+// saveDelivered saves ids created by delivered outbox entry for its idempotency key.
+func (c *Client) saveDelivered(ctx context.Context, entry OutboxEntry, response json.RawMessage) {
+	if entry.IdempotencyKey == "" || c.dedup == nil {
+		return
+	}
+	var ids []int
+	switch entry.Endpoint {
+	case messageEndpoint.path:
+		var resp struct {
+			Id int `json:"id"`
+		}
+		if json.Unmarshal(response, &resp) == nil && resp.Id != 0 {
+			ids = []int{resp.Id}
+		}
+	case addRecordsEndpoint.path:
+		_ = json.Unmarshal(response, &ids)
+	}
+	if len(ids) > 0 {
+		_ = c.dedup.store.Put(ctx, entry.IdempotencyKey, ids, c.dedup.window)
+	}
+}
+
+// paramsWithExternalId adds "external_id" to JSON object params if it is not set.
+// Params that are not JSON objects are returned unchanged.
+func paramsWithExternalId(params json.RawMessage, externalId string) (json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if len(params) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &fields); err != nil {
+			return params, nil
+		}
+	}
+	if _, ok := fields["external_id"]; ok {
+		return params, nil
+	}
+	id, err := json.Marshal(externalId)
+	if err != nil {
+		return nil, err
+	}
+	fields["external_id"] = id
+	return json.Marshal(fields)
+}
+
+// recordsWithExternalIds returns copy of records with "external_id" params derived from key.
+func recordsWithExternalIds(records []Record, key string) ([]Record, error) {
+	withIds := make([]Record, len(records))
+	for i, r := range records {
+		params, err := paramsWithExternalId(r.Params, key+":"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		r.Params = params
+		withIds[i] = r
+	}
+	return withIds, nil
+}
@@ -0,0 +1,111 @@
+package maigo
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileIdempotencyStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+	server := newTestServer(t, writeOK)
+	ctx := ContextWithIdempotencyKey(context.Background(), "key")
+
+	store, err := NewFileIdempotencyStore(path)
+	if err != nil {
+		t.Fatalf("NewFileIdempotencyStore() error = %v", err)
+	}
+	c := newTestClient(t, server, WithIdempotencyStore(store, time.Hour))
+	if _, err := c.SendMessageContext(ctx, 1, "hello"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+
+	reopened, err := NewFileIdempotencyStore(path)
+	if err != nil {
+		t.Fatalf("NewFileIdempotencyStore() error = %v", err)
+	}
+	restarted := newTestClient(t, server, WithIdempotencyStore(reopened, time.Hour))
+	if _, err := restarted.SendMessageContext(ctx, 1, "hello"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if n := server.count(messageEndpoint.path); n != 1 {
+		t.Fatalf("server got %d messages, want 1", n)
+	}
+}
+
+func TestIdempotencyKeyIsScopedByMethod(t *testing.T) {
+	server := newTestServer(t, writeRecordIds())
+	c := newTestClient(t, server, WithIdempotencyStore(NewMemoryIdempotencyStore(), 0))
+	ctx := ContextWithIdempotencyKey(context.Background(), "key")
+	now := time.Now()
+	id, err := c.AddRecordContext(ctx, 1, "pulse", "60", now, nil)
+	if err != nil {
+		t.Fatalf("AddRecord() error = %v", err)
+	}
+	ids, err := c.AddRecordsContext(ctx, 1, []Record{NewRecord("pulse", "61", now), NewRecord("pulse", "62", now)})
+	if err != nil {
+		t.Fatalf("AddRecords() error = %v", err)
+	}
+	if len(ids) != 2 || ids[0] == *id {
+		t.Fatalf("AddRecords() = %v, want 2 new ids", ids)
+	}
+}
+
+func TestIdempotencyKeyDeduplicatesConcurrentCalls(t *testing.T) {
+	server := newTestServer(t, writeOK)
+	c := newTestClient(t, server, WithIdempotencyStore(NewMemoryIdempotencyStore(), 0))
+	ctx := ContextWithIdempotencyKey(context.Background(), "key")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.SendMessageContext(ctx, 1, "hello"); err != nil {
+				t.Errorf("SendMessage() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := server.count(messageEndpoint.path); n != 1 {
+		t.Fatalf("server got %d messages, want 1", n)
+	}
+}
+
+func TestIdempotencyKeyDoesNotQueueCallTwice(t *testing.T) {
+	server := newTestServer(t, writeOK)
+	transport := &switchableTransport{}
+	c := newTestClient(t, server, WithTransport(transport),
+		WithOutbox(NewMemoryOutboxStore(), OutboxConfig{}),
+		WithIdempotencyStore(NewMemoryIdempotencyStore(), time.Hour))
+	ctx := ContextWithIdempotencyKey(context.Background(), "key")
+
+	transport.setDown(true)
+	_, err := c.SendMessageContext(ctx, 1, "hello")
+	var first *QueuedError
+	if !errors.As(err, &first) {
+		t.Fatalf("SendMessage() error = %v, want *QueuedError", err)
+	}
+	transport.setDown(false)
+	_, err = c.SendMessageContext(ctx, 1, "hello")
+	var repeated *QueuedError
+	if !errors.As(err, &repeated) || repeated.EntryId != first.EntryId {
+		t.Fatalf("repeated SendMessage() error = %v, want *QueuedError with entry %s", err, first.EntryId)
+	}
+	if entries, _ := c.Outbox().Entries(ctx); len(entries) != 1 {
+		t.Fatalf("outbox has %d entries, want 1", len(entries))
+	}
+
+	if err := c.Outbox().Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	id, err := c.SendMessageContext(ctx, 1, "hello")
+	if err != nil || id != 1 {
+		t.Fatalf("SendMessage() after delivery = %d, %v, want id of delivered message", id, err)
+	}
+	if n := server.count(messageEndpoint.path); n != 1 {
+		t.Fatalf("server got %d messages, want 1", n)
+	}
+}
@@ -0,0 +1,20 @@
+package maigo
+
+import "github.com/TikhonP/maigo/internal/json"
+
+// IncomingMessage is contract chat message that Medsenger sends to agent.
+type IncomingMessage struct {
+	Id          int                  `json:"id"`
+	Text        string               `json:"text"`
+	Sender      UserRole             `json:"sender"`
+	Timestamp   json.Timestamp       `json:"timestamp"`
+	Attachments []IncomingAttachment `json:"attachments,omitempty"`
+}
+
+// IncomingAttachment describes file attached to IncomingMessage.
+type IncomingAttachment struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"` // MIME type of the file.
+	Size int64  `json:"size"` // Size of the file in bytes.
+}
@@ -0,0 +1,47 @@
+package maigo
+
+import (
+	"context"
+	"time"
+)
+
+// SpanInfo describes API call that starts a span.
+type SpanInfo struct {
+	Endpoint   string // Request path, e.g. "/api/agents/message".
+	ContractId int    // Contract of the request, 0 for requests not bound to contract.
+}
+
+// SpanResult describes finished API call.
+type SpanResult struct {
+	StatusCode int   // Status code of the last response, 0 if no response was received.
+	Attempts   int   // Number of HTTP requests performed including retries.
+	Err        error // Call error, nil on success.
+}
+
+// Span is a traced API call.
+type Span interface {
+	End(result SpanResult)
+}
+
+// Tracer starts span for each API call of the Client. Returned context is used
+// for HTTP requests of the call, so it may carry span for transport instrumentation.
+type Tracer interface {
+	StartSpan(ctx context.Context, info SpanInfo) (context.Context, Span)
+}
+
+// Metrics receives measurements of each HTTP request performed by Client, including retries.
+type Metrics interface {
+	CountRequest(endpoint string, statusCode int, failed bool)
+	ObserveLatency(endpoint string, latency time.Duration)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) End(SpanResult) {}
+
+func (c *Client) startSpan(ctx context.Context, ep endpoint, contractId int) (context.Context, Span) {
+	if c.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return c.tracer.StartSpan(ctx, SpanInfo{Endpoint: ep.path, ContractId: contractId})
+}
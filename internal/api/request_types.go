@@ -8,3 +8,31 @@ type TokenAndContractRequest struct {
 	TokenOnlyRequest
 	ContractId int `json:"contract_id"`
 }
+
+// Contract returns contract identifier of the request.
+func (r TokenAndContractRequest) Contract() int {
+	return r.ContractId
+}
+
+// ContractRequest is implemented by requests embedding TokenAndContractRequest.
+type ContractRequest interface {
+	Contract() int
+}
+
+// ContractOf returns contract identifier of request or 0 if request is not bound to contract.
+func ContractOf(request any) int {
+	if r, ok := request.(ContractRequest); ok {
+		return r.Contract()
+	}
+	return 0
+}
+
+// SetApiKey sets api key of the request.
+func (r *TokenOnlyRequest) SetApiKey(apiKey string) {
+	r.ApiKey = apiKey
+}
+
+// ApiKeySetter is implemented by pointers to requests embedding TokenOnlyRequest.
+type ApiKeySetter interface {
+	SetApiKey(apiKey string)
+}
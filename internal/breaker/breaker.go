@@ -0,0 +1,205 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by Breaker.Allow when requests are rejected.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is a state of Breaker.
+type State int
+
+const (
+	Closed   State = iota // Requests are allowed.
+	Open                  // Requests are rejected.
+	HalfOpen              // Limited number of trial requests is allowed.
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Outcome is a result of request allowed by Breaker.
+type Outcome int
+
+const (
+	Success  Outcome = iota // Request reached healthy service.
+	Failure                 // Request failed because service is unavailable.
+	Canceled                // Request was abandoned and tells nothing about service.
+)
+
+// Settings configures Breaker.
+type Settings struct {
+	FailureThreshold int           // Consecutive failures that open the breaker, 5 if not set.
+	OpenTimeout      time.Duration // Time in open state before trial requests, 30s if not set.
+	HalfOpenRequests int           // Successful trial requests that close the breaker, 1 if not set.
+
+	// OnStateChange is called with breaker name when its state changes.
+	// It is called without breaker lock held, so it may query breaker state.
+	OnStateChange func(name string, from, to State)
+}
+
+func (s Settings) withDefaults() Settings {
+	if s.FailureThreshold <= 0 {
+		s.FailureThreshold = 5
+	}
+	if s.OpenTimeout <= 0 {
+		s.OpenTimeout = 30 * time.Second
+	}
+	if s.HalfOpenRequests <= 0 {
+		s.HalfOpenRequests = 1
+	}
+	return s
+}
+
+// Breaker rejects requests after consecutive failures until timeout passes
+// and trial requests succeed. It is safe for concurrent use.
+type Breaker struct {
+	name     string
+	settings Settings
+
+	mu        sync.Mutex
+	state     State
+	failures  int       // Consecutive failures in closed state.
+	openedAt  time.Time // Time of the last transition to open state.
+	trials    int       // Trial requests in flight in half-open state.
+	successes int       // Successful trial requests in half-open state.
+	changes   []change  // Transitions to report after b.mu is released.
+}
+
+type change struct {
+	from, to State
+}
+
+// New creates Breaker in closed state.
+func New(name string, settings Settings) *Breaker {
+	return &Breaker{name: name, settings: settings.withDefaults()}
+}
+
+// State returns current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.unlock()
+	b.checkTimeout()
+	return b.state
+}
+
+// Allow returns ErrOpen if request must be rejected. Otherwise caller must report
+// request outcome with done.
+func (b *Breaker) Allow() (done func(Outcome), err error) {
+	b.mu.Lock()
+	defer b.unlock()
+	b.checkTimeout()
+	switch b.state {
+	case Open:
+		return nil, ErrOpen
+	case HalfOpen:
+		if b.trials+b.successes >= b.settings.HalfOpenRequests {
+			return nil, ErrOpen
+		}
+		b.trials++
+		return b.halfOpenDone, nil
+	}
+	return b.closedDone, nil
+}
+
+func (b *Breaker) closedDone(outcome Outcome) {
+	b.mu.Lock()
+	defer b.unlock()
+	if b.state != Closed || outcome == Canceled {
+		return
+	}
+	if outcome == Success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.settings.FailureThreshold {
+		b.setState(Open)
+	}
+}
+
+func (b *Breaker) halfOpenDone(outcome Outcome) {
+	b.mu.Lock()
+	defer b.unlock()
+	if b.state != HalfOpen {
+		return
+	}
+	b.trials--
+	switch outcome {
+	case Canceled:
+		return
+	case Failure:
+		b.setState(Open)
+		return
+	}
+	b.successes++
+	if b.successes >= b.settings.HalfOpenRequests {
+		b.setState(Closed)
+	}
+}
+
+// checkTimeout moves open breaker to half-open state after timeout. Must be called with b.mu held.
+func (b *Breaker) checkTimeout() {
+	if b.state == Open && time.Since(b.openedAt) >= b.settings.OpenTimeout {
+		b.setState(HalfOpen)
+	}
+}
+
+// setState must be called with b.mu held.
+func (b *Breaker) setState(state State) {
+	from := b.state
+	b.state = state
+	b.failures, b.trials, b.successes = 0, 0, 0
+	if state == Open {
+		b.openedAt = time.Now()
+	}
+	if b.settings.OnStateChange != nil {
+		b.changes = append(b.changes, change{from: from, to: state})
+	}
+}
+
+// unlock releases b.mu and reports state transitions made while it was held.
+func (b *Breaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+	for _, c := range changes {
+		b.settings.OnStateChange(b.name, c.from, c.to)
+	}
+}
+
+// Set holds breakers created on demand by name.
+type Set struct {
+	settings Settings
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewSet creates Set with breakers using settings.
+func NewSet(settings Settings) *Set {
+	return &Set{settings: settings, breakers: make(map[string]*Breaker)}
+}
+
+// Get returns breaker for name, creating it if needed.
+func (s *Set) Get(name string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.breakers[name]
+	if !ok {
+		b = New(name, s.settings)
+		s.breakers[name] = b
+	}
+	return b
+}
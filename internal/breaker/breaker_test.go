@@ -0,0 +1,85 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAndCloses(t *testing.T) {
+	b := New("test", Settings{FailureThreshold: 2, OpenTimeout: 10 * time.Millisecond})
+	for i := 0; i < 2; i++ {
+		done, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		done(Failure)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Allow() error = %v, want ErrOpen", err)
+	}
+	time.Sleep(15 * time.Millisecond)
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("State() = %v, want half-open", got)
+	}
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("second trial Allow() error = %v, want ErrOpen", err)
+	}
+	done(Success)
+	if got := b.State(); got != Closed {
+		t.Fatalf("State() = %v, want closed", got)
+	}
+}
+
+func TestBreakerCanceledTrialIsNotSuccess(t *testing.T) {
+	b := New("test", Settings{FailureThreshold: 1, OpenTimeout: time.Millisecond})
+	done, _ := b.Allow()
+	done(Failure)
+	time.Sleep(2 * time.Millisecond)
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	done(Canceled)
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("State() = %v, want half-open", got)
+	}
+}
+
+func TestOnStateChangeMayQueryBreaker(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		changes []State
+		b       *Breaker
+	)
+	b = New("test", Settings{
+		FailureThreshold: 1,
+		OnStateChange: func(name string, from, to State) {
+			state := b.State()
+			mu.Lock()
+			changes = append(changes, state)
+			mu.Unlock()
+		},
+	})
+	finished := make(chan struct{})
+	go func() {
+		done, _ := b.Allow()
+		done(Failure)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("done deadlocked in OnStateChange")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != 1 || changes[0] != Open {
+		t.Fatalf("changes = %v, want [open]", changes)
+	}
+}
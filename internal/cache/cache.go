@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Stats describes cache usage.
+type Stats struct {
+	Hits      uint64 // Requests served from fresh entries.
+	Misses    uint64 // Requests that fetched value.
+	StaleHits uint64 // Requests served from expired entries because fetch failed.
+	Coalesced uint64 // Requests that waited for concurrent identical fetch.
+}
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// call is a fetch in flight shared by concurrent requests.
+type call[V any] struct {
+	done        chan struct{}
+	value       V
+	err         error
+	canceled    bool // Fetch failed because context of the request started it is done.
+	invalidated bool // Key was invalidated during fetch, so value is not stored.
+}
+
+// Cache stores fetched values for TTL and coalesces concurrent fetches of the same key.
+// Nil *Cache fetches value on each request. It is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	ttl        time.Duration
+	serveStale func(err error) bool
+
+	mu      sync.Mutex
+	entries map[K]entry[V]
+	calls   map[K]*call[V]
+	stats   Stats
+	sweptAt time.Time // Time expired entries were last removed.
+}
+
+// New creates Cache keeping values for ttl. If serveStale is not nil, expired value
+// is returned when fetch fails with error it reports true for, and removed otherwise.
+// Without serveStale expired values are removed.
+func New[K comparable, V any](ttl time.Duration, serveStale func(err error) bool) *Cache[K, V] {
+	return &Cache[K, V]{
+		ttl:        ttl,
+		serveStale: serveStale,
+		entries:    make(map[K]entry[V]),
+		calls:      make(map[K]*call[V]),
+		sweptAt:    time.Now(),
+	}
+}
+
+// Get returns cached value for key or fetches it. Concurrent requests of the same key wait
+// for a single fetch; if it fails because context of the request started it is done,
+// waiting requests fetch again with their own contexts.
+func (c *Cache[K, V]) Get(ctx context.Context, key K, fetch func(ctx context.Context) (V, error)) (V, error) {
+	if c == nil {
+		return fetch(ctx)
+	}
+	for {
+		c.mu.Lock()
+		e, cached := c.entries[key]
+		if cached && time.Now().Before(e.expires) {
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.value, nil
+		}
+		cl, ok := c.calls[key]
+		if !ok {
+			break
+		}
+		c.stats.Coalesced++
+		c.mu.Unlock()
+		select {
+		case <-cl.done:
+			if cl.canceled && cl.err != nil && ctx.Err() == nil {
+				continue
+			}
+			return cl.value, cl.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+	c.stats.Misses++
+	cl := &call[V]{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.mu.Unlock()
+
+	cl.value, cl.err = fetch(ctx)
+	cl.canceled = cl.err != nil && ctx.Err() != nil
+
+	c.mu.Lock()
+	if c.calls[key] == cl {
+		delete(c.calls, key)
+	}
+	switch e, ok := c.entries[key]; {
+	case cl.err == nil:
+		if !cl.invalidated {
+			c.sweep()
+			c.entries[key] = entry[V]{value: cl.value, expires: time.Now().Add(c.ttl)}
+		}
+	case ok && c.serveStale != nil && c.serveStale(cl.err):
+		c.stats.StaleHits++
+		cl.value, cl.err = e.value, nil
+	case !cl.canceled:
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(cl.done)
+	return cl.value, cl.err
+}
+
+// sweep removes expired values at most once per TTL unless they may be served stale,
+// so values of keys that are not requested anymore do not accumulate.
+func (c *Cache[K, V]) sweep() {
+	now := time.Now()
+	if c.serveStale != nil || now.Sub(c.sweptAt) < c.ttl {
+		return
+	}
+	c.sweptAt = now
+	for key, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Invalidate removes value of key. Value of fetch in flight is not stored.
+func (c *Cache[K, V]) Invalidate(key K) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	if cl, ok := c.calls[key]; ok {
+		cl.invalidated = true
+		delete(c.calls, key)
+	}
+}
+
+// InvalidateAll removes all values. Values of fetches in flight are not stored.
+func (c *Cache[K, V]) InvalidateAll() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[K]entry[V])
+	for key, cl := range c.calls {
+		cl.invalidated = true
+		delete(c.calls, key)
+	}
+}
+
+// Stats returns cache usage statistics.
+func (c *Cache[K, V]) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetCachesValue(t *testing.T) {
+	c := New[int, int](time.Minute, nil)
+	var fetches int32
+	fetch := func(ctx context.Context) (int, error) {
+		return int(atomic.AddInt32(&fetches, 1)), nil
+	}
+	for i := 0; i < 3; i++ {
+		if v, err := c.Get(context.Background(), 1, fetch); err != nil || v != 1 {
+			t.Fatalf("Get() = %d, %v, want 1, nil", v, err)
+		}
+	}
+	if s := c.Stats(); s.Misses != 1 || s.Hits != 2 {
+		t.Fatalf("Stats() = %+v", s)
+	}
+}
+
+func TestGetCoalescesConcurrentFetches(t *testing.T) {
+	c := New[int, int](time.Minute, nil)
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (int, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return 42, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get(context.Background(), 1, fetch); err != nil || v != 42 {
+				t.Errorf("Get() = %d, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("fetch called %d times, want 1", n)
+	}
+}
+
+func TestWaitersRefetchWhenFirstRequestIsCanceled(t *testing.T) {
+	c := New[int, int](time.Minute, nil)
+	started := make(chan struct{})
+	var fetches int32
+	fetch := func(ctx context.Context) (int, error) {
+		if atomic.AddInt32(&fetches, 1) == 1 {
+			close(started)
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return 7, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, 1, fetch)
+		leaderDone <- err
+	}()
+	<-started
+	waiterDone := make(chan int, 1)
+	go func() {
+		v, err := c.Get(context.Background(), 1, fetch)
+		if err != nil {
+			t.Errorf("waiter Get() error = %v", err)
+		}
+		waiterDone <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader Get() error = %v, want context.Canceled", err)
+	}
+	if v := <-waiterDone; v != 7 {
+		t.Fatalf("waiter Get() = %d, want 7", v)
+	}
+}
+
+func TestInvalidateDuringFetchDiscardsValue(t *testing.T) {
+	c := New[int, int](time.Minute, nil)
+	started, release := make(chan struct{}), make(chan struct{})
+	go func() {
+		_, _ = c.Get(context.Background(), 1, func(ctx context.Context) (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+	}()
+	<-started
+	c.Invalidate(1)
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	v, err := c.Get(context.Background(), 1, func(ctx context.Context) (int, error) { return 2, nil })
+	if err != nil || v != 2 {
+		t.Fatalf("Get() after Invalidate = %d, %v, want 2, nil", v, err)
+	}
+}
+
+func TestServeStale(t *testing.T) {
+	errDown, errNotFound := errors.New("down"), errors.New("not found")
+	c := New[int, int](time.Millisecond, func(err error) bool { return err == errDown })
+	_, _ = c.Get(context.Background(), 1, func(ctx context.Context) (int, error) { return 1, nil })
+	time.Sleep(2 * time.Millisecond)
+	v, err := c.Get(context.Background(), 1, func(ctx context.Context) (int, error) { return 0, errDown })
+	if err != nil || v != 1 {
+		t.Fatalf("Get() = %d, %v, want stale 1, nil", v, err)
+	}
+	if _, err := c.Get(context.Background(), 1, func(ctx context.Context) (int, error) { return 0, errNotFound }); err != errNotFound {
+		t.Fatalf("Get() error = %v, want %v", err, errNotFound)
+	}
+	// Value is evicted by error that must not be served stale.
+	if _, err := c.Get(context.Background(), 1, func(ctx context.Context) (int, error) { return 0, errDown }); err != errDown {
+		t.Fatalf("Get() after eviction error = %v, want %v", err, errDown)
+	}
+}
+
+func TestExpiredValuesAreRemoved(t *testing.T) {
+	c := New[int, int](time.Millisecond, nil)
+	for key := 0; key < 10; key++ {
+		_, _ = c.Get(context.Background(), key, func(ctx context.Context) (int, error) { return key, nil })
+	}
+	time.Sleep(2 * time.Millisecond)
+	_, _ = c.Get(context.Background(), 10, func(ctx context.Context) (int, error) { return 10, nil })
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.entries); n != 1 {
+		t.Fatalf("cache has %d entries, want 1", n)
+	}
+}
@@ -0,0 +1,65 @@
+package limit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket rate limiter. It is safe for concurrent use.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second.
+	burst  float64 // Bucket capacity.
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates Bucket allowing rate events per second with bursts of at most burst events.
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns delay after which it becomes available.
+func (b *Bucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *Bucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+}
+
+// Wait blocks until event is allowed or ctx is done. It returns time spent waiting.
+func (b *Bucket) Wait(ctx context.Context) (time.Duration, error) {
+	delay := b.reserve()
+	if delay == 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		b.cancel()
+		return time.Since(start), ctx.Err()
+	case <-timer.C:
+		return delay, nil
+	}
+}
@@ -0,0 +1,69 @@
+package limit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBucketWaitsForTokens(t *testing.T) {
+	b := NewBucket(100, 2)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := b.Wait(ctx); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	// Burst of 2 passes immediately, 2 more tokens take about 20ms.
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Fatalf("4 events took %v, want at least 15ms", elapsed)
+	}
+}
+
+func TestBucketWaitCanceled(t *testing.T) {
+	b := NewBucket(1, 1)
+	if _, err := b.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSemaphoreLimitsConcurrency(t *testing.T) {
+	s := NewSemaphore(3)
+	var (
+		wg            sync.WaitGroup
+		inFlight, max int32
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+			s.Release()
+		}()
+	}
+	wg.Wait()
+	if max > 3 {
+		t.Fatalf("max concurrency = %d, want at most 3", max)
+	}
+}
@@ -0,0 +1,35 @@
+package limit
+
+import (
+	"context"
+	"time"
+)
+
+// Semaphore limits number of concurrent operations.
+type Semaphore chan struct{}
+
+// NewSemaphore creates Semaphore allowing n concurrent operations.
+func NewSemaphore(n int) Semaphore {
+	return make(Semaphore, n)
+}
+
+// Acquire blocks until operation is allowed or ctx is done. It returns time spent waiting.
+func (s Semaphore) Acquire(ctx context.Context) (time.Duration, error) {
+	select {
+	case s <- struct{}{}:
+		return 0, nil
+	default:
+	}
+	start := time.Now()
+	select {
+	case s <- struct{}{}:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// Release finishes operation started with Acquire.
+func (s Semaphore) Release() {
+	<-s
+}
@@ -2,53 +2,175 @@ package net
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
 	"net/http"
 	"net/url"
 )
 
-func MakeRequest[Request any, Response any](url *url.URL, data Request) (*Response, error) {
-	var response *Response
+// ErrResponseTooLarge is returned when response body exceeds Config.MaxResponseSize.
+var ErrResponseTooLarge = errors.New("response body is too large")
+
+// Config describes how request is performed.
+type Config struct {
+	Client          *http.Client // Client performing request.
+	URL             *url.URL     // Request URL.
+	Exchange        *Exchange    // Records request details if not nil.
+	MaxResponseSize int64        // Limit of decompressed response body size, no limit if 0.
+}
+
+// maxCapturedBodySize limits amount of body kept in Exchange.
+const maxCapturedBodySize = 64 << 10
+
+// Exchange records details of performed request for logging.
+type Exchange struct {
+	CaptureBodies bool   // Whether request and response bodies are recorded.
+	RequestBody   []byte // Encoded request.
+	StatusCode    int    // Response status code, 0 if no response was received.
+	ResponseBody  []byte // Beginning of the response body.
+}
+
+// post sends encoded data within ctx and returns response with checked status.
+// Non-OK responses are reported as *StatusError.
+func post(ctx context.Context, cfg Config, data any) (*http.Response, error) {
 	encodedData, encodeJsonErr := json.Marshal(data)
 	if encodeJsonErr != nil {
-		return response, encodeJsonErr
+		return nil, encodeJsonErr
 	}
-
-	// log.Println("encodedData", string(encodedData))
-
-	httpResponse, httpErr := http.Post(url.String(), "application/json", bytes.NewBuffer(encodedData))
+	if cfg.Exchange != nil && cfg.Exchange.CaptureBodies {
+		cfg.Exchange.RequestBody = encodedData
+	}
+	httpRequest, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL.String(), bytes.NewBuffer(encodedData))
+	if requestErr != nil {
+		return nil, requestErr
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Accept-Encoding", "gzip")
+	httpResponse, httpErr := cfg.Client.Do(httpRequest)
 	if httpErr != nil {
-		return response, httpErr
+		return nil, httpErr
+	}
+	if cfg.Exchange != nil {
+		cfg.Exchange.StatusCode = httpResponse.StatusCode
 	}
 	if httpResponse.StatusCode != http.StatusOK {
-		return response, fmt.Errorf("MakeRequest: response status code is not OK: %s", httpResponse.Status)
+		statusErr := newStatusError(httpResponse)
+		if cfg.Exchange != nil && cfg.Exchange.CaptureBodies {
+			cfg.Exchange.ResponseBody = statusErr.Body
+		}
+		return nil, statusErr
 	}
+	return httpResponse, nil
+}
 
-	defer httpResponse.Body.Close()
-
-	// respDump, err := httputil.DumpResponse(httpResponse, true)
-	// if err != nil {
-	// 	log.Fatal(err)
-	// }
-	// log.Printf("RESPONSE:\n%s", string(respDump))
+// body returns decompressed response body limited to MaxResponseSize.
+// Beginning of the body is recorded to the exchange if needed.
+func (cfg Config) body(httpResponse *http.Response) (io.Reader, error) {
+	var body io.Reader = httpResponse.Body
+	if httpResponse.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		body = gzipReader
+	}
+	if cfg.MaxResponseSize > 0 {
+		body = &limitedReader{r: body, n: cfg.MaxResponseSize}
+	}
+	if cfg.Exchange != nil && cfg.Exchange.CaptureBodies {
+		body = io.TeeReader(body, &limitedWriter{buf: &cfg.Exchange.ResponseBody, n: maxCapturedBodySize})
+	}
+	return body, nil
+}
 
-	decodeJsonErr := json.NewDecoder(httpResponse.Body).Decode(&response)
-	return response, decodeJsonErr
+// MakeRequest posts data and decodes JSON response. Cancellation of ctx aborts
+// both the HTTP call and reading of the response body.
+func MakeRequest[Request any, Response any](ctx context.Context, cfg Config, data Request) (*Response, error) {
+	var response *Response
+	err := MakeStreamRequest(ctx, cfg, data, func(decoder *json.Decoder) error {
+		return decoder.Decode(&response)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
 }
 
-func MakeRequestWithEmptyResponse[Request any](url *url.URL, data Request) error {
-	encodedData, encodeJsonErr := json.Marshal(data)
-	if encodeJsonErr != nil {
-		return encodeJsonErr
+// MakeStreamRequest posts data and passes decoder of JSON response to decode.
+func MakeStreamRequest[Request any](ctx context.Context, cfg Config, data Request, decode func(decoder *json.Decoder) error) error {
+	httpResponse, err := post(ctx, cfg, data)
+	if err != nil {
+		return err
 	}
-	httpResponse, httpErr := http.Post(url.String(), "application/json", bytes.NewBuffer(encodedData))
-	if httpErr != nil {
-		return httpErr
+	defer httpResponse.Body.Close()
+
+	body, err := cfg.body(httpResponse)
+	if err != nil {
+		return err
 	}
-	if httpResponse.StatusCode != http.StatusOK {
-		return fmt.Errorf("MakeRequest: response status code is not OK: %s", httpResponse.Status)
+	if decodeJsonErr := decode(json.NewDecoder(body)); decodeJsonErr != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return decodeJsonErr
+	}
+	return nil
+}
+
+// MakeRequestWithEmptyResponse posts data and ignores response body.
+func MakeRequestWithEmptyResponse[Request any](ctx context.Context, cfg Config, data Request) error {
+	httpResponse, err := post(ctx, cfg, data)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+	if cfg.Exchange != nil && cfg.Exchange.CaptureBodies {
+		if body, err := cfg.body(httpResponse); err == nil {
+			_, _ = io.Copy(io.Discard, body)
+		}
 	}
 	return nil
 }
 
+// limitedReader reads at most n bytes from r and fails with ErrResponseTooLarge after that.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		// Check if there is more data before reporting an error.
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// limitedWriter appends at most n bytes to buf and discards the rest.
+type limitedWriter struct {
+	buf *[]byte
+	n   int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if rest := w.n - len(*w.buf); rest > 0 {
+		if len(p) < rest {
+			rest = len(p)
+		}
+		*w.buf = append(*w.buf, p[:rest]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,171 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	stdnet "net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures retries of failed requests.
+//
+// Zero value disables retries.
+type RetryPolicy struct {
+	MaxAttempts    int           // Total number of attempts including the first one.
+	InitialBackoff time.Duration // Delay before the first retry.
+	MaxBackoff     time.Duration // Upper bound of the delay between attempts.
+	Multiplier     float64       // Growth factor of the delay, 2 if not set.
+	Jitter         float64       // Fraction of the delay randomized, from 0 to 1.
+	MaxRetryAfter  time.Duration // Longer Retry-After values stop retries. Zero means MaxBackoff.
+	Budget         *RetryBudget  // Optional budget shared between requests.
+}
+
+// backoff returns delay before retry following attempt. Negative value means no retry.
+func (p *RetryPolicy) backoff(attempt int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		if retryAfter, ok := parseRetryAfter(statusErr.Header.Get("Retry-After")); ok {
+			limit := p.MaxRetryAfter
+			if limit == 0 {
+				limit = p.MaxBackoff
+			}
+			if limit > 0 && retryAfter > limit {
+				return -1
+			}
+			return retryAfter
+		}
+	}
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * p.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// RetryBudget limits retries to a fraction of requests, so retries do not
+// multiply load during long outages. It is safe for concurrent use.
+type RetryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+// NewRetryBudget creates RetryBudget allowing ratio retries per request
+// with at most burst retries accumulated.
+func NewRetryBudget(ratio float64, burst int) *RetryBudget {
+	return &RetryBudget{ratio: ratio, max: float64(burst), tokens: float64(burst)}
+}
+
+func (b *RetryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.max, b.tokens+b.ratio)
+}
+
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Retry calls do until it succeeds, returns not retryable error or policy is exhausted.
+// Idempotent tells whether request can be repeated after it possibly reached the server.
+func Retry(ctx context.Context, policy RetryPolicy, idempotent bool, do func(ctx context.Context) error) error {
+	policy.Budget.deposit()
+	for attempt := 1; ; attempt++ {
+		err := do(ctx)
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !Retryable(err, idempotent) {
+			return err
+		}
+		delay := policy.backoff(attempt, err)
+		if delay < 0 || !policy.Budget.withdraw() {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Retryable reports whether request failed with err can be repeated.
+//
+// Requests that are not idempotent are retried only when the server certainly
+// did not process them: connection was not established or request was throttled.
+func Retryable(err error, idempotent bool) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return true
+		case http.StatusRequestTimeout, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return idempotent
+		}
+		return false
+	}
+	if IsDialError(err) {
+		return true
+	}
+	var netErr stdnet.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return idempotent
+	}
+	return false
+}
+
+// IsDialError reports whether err happened before connection to the server was established.
+func IsDialError(err error) bool {
+	var opErr *stdnet.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *stdnet.DNSError
+	return errors.As(err, &dnsErr)
+}
@@ -0,0 +1,171 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	stdnet "net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func statusError(code int, header http.Header) error {
+	return &StatusError{Status: http.StatusText(code), StatusCode: code, Header: header}
+}
+
+func TestRetryable(t *testing.T) {
+	post := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://medsenger.ru/api/agents/message", Err: err}
+	}
+	tests := []struct {
+		name          string
+		err           error
+		idempotent    bool
+		notIdempotent bool
+	}{
+		{"dial error", post(&stdnet.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), true, true},
+		{"dns error", post(&stdnet.OpError{Op: "dial", Net: "tcp", Err: &stdnet.DNSError{Err: "no such host", Name: "medsenger.ru"}}), true, true},
+		{"dial timeout", post(&stdnet.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}), true, true},
+		{"429", statusError(http.StatusTooManyRequests, nil), true, true},
+		{"500", statusError(http.StatusInternalServerError, nil), true, false},
+		{"502", statusError(http.StatusBadGateway, nil), true, false},
+		{"503", statusError(http.StatusServiceUnavailable, nil), true, false},
+		{"504", statusError(http.StatusGatewayTimeout, nil), true, false},
+		{"408", statusError(http.StatusRequestTimeout, nil), true, false},
+		{"400", statusError(http.StatusBadRequest, nil), false, false},
+		{"404", statusError(http.StatusNotFound, nil), false, false},
+		{"501", statusError(http.StatusNotImplemented, nil), false, false},
+		{"read timeout", post(&stdnet.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}), true, false},
+		{"connection reset", post(&stdnet.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}), true, false},
+		{"unexpected EOF", post(io.ErrUnexpectedEOF), true, false},
+		{"EOF", post(io.EOF), true, false},
+		{"canceled", post(context.Canceled), false, false},
+		{"deadline exceeded", post(context.DeadlineExceeded), false, false},
+		{"other error", errors.New("json: cannot unmarshal"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Retryable(tt.err, true); got != tt.idempotent {
+				t.Errorf("Retryable(err, true) = %v, want %v", got, tt.idempotent)
+			}
+			if got := Retryable(tt.err, false); got != tt.notIdempotent {
+				t.Errorf("Retryable(err, false) = %v, want %v", got, tt.notIdempotent)
+			}
+		})
+	}
+}
+
+func TestRetryStopsAfterMaxAttempts(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	attempts := 0
+	err := Retry(context.Background(), policy, true, func(context.Context) error {
+		attempts++
+		return statusError(http.StatusServiceUnavailable, nil)
+	})
+	if err == nil || attempts != 3 {
+		t.Fatalf("Retry() = %v after %d attempts, want error after 3", err, attempts)
+	}
+}
+
+func TestRetryDoesNotRepeatNotIdempotentRequestAfter5xx(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	attempts := 0
+	_ = Retry(context.Background(), policy, false, func(context.Context) error {
+		attempts++
+		return statusError(http.StatusBadGateway, nil)
+	})
+	if attempts != 1 {
+		t.Fatalf("request was attempted %d times, want 1", attempts)
+	}
+}
+
+func TestRetryAfterCap(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		policy     RetryPolicy
+		attempts   int
+	}{
+		{"within MaxRetryAfter", "0", RetryPolicy{MaxAttempts: 2, MaxRetryAfter: time.Second}, 2},
+		{"above MaxRetryAfter", "10", RetryPolicy{MaxAttempts: 2, MaxRetryAfter: time.Second}, 1},
+		{"above MaxBackoff without MaxRetryAfter", "10", RetryPolicy{MaxAttempts: 2, MaxBackoff: time.Second}, 1},
+		{"past date", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), RetryPolicy{MaxAttempts: 2, MaxRetryAfter: time.Second}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			start := time.Now()
+			_ = Retry(context.Background(), tt.policy, false, func(context.Context) error {
+				attempts++
+				return statusError(http.StatusTooManyRequests, http.Header{"Retry-After": {tt.retryAfter}})
+			})
+			if attempts != tt.attempts {
+				t.Fatalf("request was attempted %d times, want %d", attempts, tt.attempts)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Fatalf("Retry() waited %v", d)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetExhaustion(t *testing.T) {
+	budget := NewRetryBudget(0, 2)
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Millisecond, Budget: budget}
+	attempts := 0
+	failing := func(context.Context) error {
+		attempts++
+		return statusError(http.StatusServiceUnavailable, nil)
+	}
+	_ = Retry(context.Background(), policy, true, failing)
+	if attempts != 3 {
+		t.Fatalf("first request was attempted %d times, want 1 attempt and 2 retries of the budget", attempts)
+	}
+	attempts = 0
+	_ = Retry(context.Background(), policy, true, failing)
+	if attempts != 1 {
+		t.Fatalf("request was attempted %d times after budget was exhausted, want 1", attempts)
+	}
+}
+
+func TestRetryBudgetIsRefilledByRequests(t *testing.T) {
+	budget := NewRetryBudget(0.5, 1)
+	budget.tokens = 0
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Millisecond, Budget: budget}
+	var attempts []int
+	for i := 0; i < 4; i++ {
+		n := 0
+		_ = Retry(context.Background(), policy, true, func(context.Context) error {
+			n++
+			return statusError(http.StatusServiceUnavailable, nil)
+		})
+		attempts = append(attempts, n)
+	}
+	if got := fmt.Sprint(attempts); got != "[1 2 1 2]" {
+		t.Fatalf("attempts per request = %s, want [1 2 1 2]", got)
+	}
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := Retry(ctx, policy, true, func(context.Context) error {
+		return statusError(http.StatusServiceUnavailable, nil)
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Retry() error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,34 @@
+package net
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxErrorBodySize limits amount of response body kept in StatusError.
+const maxErrorBodySize = 64 << 10
+
+// StatusError is returned when response status code is not OK.
+type StatusError struct {
+	Status     string      // Response status line, e.g. "404 Not Found".
+	StatusCode int         // Response status code.
+	Header     http.Header // Response headers.
+	Body       []byte      // Beginning of the response body.
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("response status code is not OK: %s", e.Status)
+}
+
+// newStatusError reads and closes response body.
+func newStatusError(resp *http.Response) *StatusError {
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return &StatusError{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}
+}
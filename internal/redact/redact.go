@@ -0,0 +1,56 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Placeholder replaces redacted values.
+const Placeholder = "[REDACTED]"
+
+// JSON returns copy of JSON document data with values of keys replaced by Placeholder
+// at any depth. Invalid JSON is replaced entirely.
+func JSON(data []byte, keys map[string]bool) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return []byte(Placeholder)
+	}
+	redacted, err := json.Marshal(value(v, keys))
+	if err != nil {
+		return []byte(Placeholder)
+	}
+	return redacted
+}
+
+func value(v any, keys map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			if keys[k] {
+				if item != nil {
+					v[k] = Placeholder
+				}
+				continue
+			}
+			v[k] = value(item, keys)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = value(item, keys)
+		}
+	}
+	return v
+}
+
+// Secret hides all but the last four characters of s.
+func Secret(s string) string {
+	if len(s) <= 8 {
+		return Placeholder
+	}
+	return "****" + s[len(s)-4:]
+}
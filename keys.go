@@ -0,0 +1,160 @@
+package maigo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TikhonP/maigo/internal/api"
+)
+
+// KeyProvider supplies api key assigned to agent. It is consulted before each
+// request attempt, so rotated key is used by new requests and retries of in-flight ones.
+type KeyProvider interface {
+	APIKey(ctx context.Context) (string, error)
+}
+
+// KeyProviderFunc is an adapter to allow the use of ordinary functions as KeyProvider.
+type KeyProviderFunc func(ctx context.Context) (string, error)
+
+func (f KeyProviderFunc) APIKey(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+type staticKey string
+
+func (k staticKey) APIKey(context.Context) (string, error) {
+	return string(k), nil
+}
+
+// StaticKey returns KeyProvider which always supplies apiKey.
+func StaticKey(apiKey string) KeyProvider {
+	return staticKey(apiKey)
+}
+
+// ErrNoAPIKey is returned by KeyProvider when api key is not available.
+var ErrNoAPIKey = errors.New("maigo: api key is not set")
+
+type envKey string
+
+func (k envKey) APIKey(context.Context) (string, error) {
+	apiKey := os.Getenv(string(k))
+	if apiKey == "" {
+		return "", fmt.Errorf("%w: environment variable %s is empty", ErrNoAPIKey, string(k))
+	}
+	return apiKey, nil
+}
+
+// EnvKey returns KeyProvider which reads api key from environment variable name on each call.
+func EnvKey(name string) KeyProvider {
+	return envKey(name)
+}
+
+// FileKeyProvider supplies api key stored in file. File is checked for changes
+// at most once per interval, so key can be rotated by replacing the file.
+type FileKeyProvider struct {
+	path     string
+	interval time.Duration
+
+	mu        sync.Mutex
+	apiKey    string
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewFileKeyProvider creates FileKeyProvider reading api key from path.
+// Surrounding whitespace is trimmed. If interval is 0, file is checked every 10 seconds.
+// The file is read immediately so missing file is reported early.
+func NewFileKeyProvider(path string, interval time.Duration) (*FileKeyProvider, error) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	p := &FileKeyProvider{path: path, interval: interval}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// APIKey returns api key from the file, rereading it if it was modified.
+func (p *FileKeyProvider) APIKey(context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.checkedAt) >= p.interval {
+		if err := p.load(false); err != nil {
+			return "", err
+		}
+	}
+	return p.apiKey, nil
+}
+
+// Reload rereads the file regardless of its modification time,
+// e.g. from WithUnauthorizedHook.
+func (p *FileKeyProvider) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.load(true)
+}
+
+func (p *FileKeyProvider) load(force bool) error {
+	p.checkedAt = time.Now()
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	if !force && info.ModTime().Equal(p.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	apiKey := string(bytes.TrimSpace(data))
+	if apiKey == "" {
+		return fmt.Errorf("%w: file %s is empty", ErrNoAPIKey, p.path)
+	}
+	p.apiKey = apiKey
+	p.modTime = info.ModTime()
+	return nil
+}
+
+// setApiKey sets current api key to request if it carries one.
+func (c *Client) setApiKey(ctx context.Context, request any) error {
+	setter, ok := request.(api.ApiKeySetter)
+	if !ok {
+		return nil
+	}
+	apiKey, err := c.keys.APIKey(ctx)
+	if err != nil {
+		return fmt.Errorf("maigo: api key provider: %w", err)
+	}
+	setter.SetApiKey(apiKey)
+	return nil
+}
+
+// VerifyAPIKey reports whether apiKey equals current api key of Client.
+// Keys are compared in constant time, so it is safe to check keys sent to agent by Medsenger.
+func (c *Client) VerifyAPIKey(ctx context.Context, apiKey string) bool {
+	expected, err := c.keys.APIKey(ctx)
+	if err != nil || expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(apiKey)) == 1
+}
+
+// keyFingerprint returns short hash of current key of keys identifying agent in shared stores.
+func keyFingerprint(keys KeyProvider) (string, error) {
+	apiKey, err := keys.APIKey(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("maigo: api key provider: %w", err)
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8]), nil
+}
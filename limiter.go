@@ -0,0 +1,105 @@
+package maigo
+
+import (
+	"context"
+	"time"
+
+	"github.com/TikhonP/maigo/internal/limit"
+)
+
+// WaitObserver is called when request waited for rate limiter or concurrency cap.
+type WaitObserver func(endpoint string, group EndpointGroup, wait time.Duration)
+
+type rateLimit struct {
+	rate  float64
+	burst int
+}
+
+// limits holds rate limit and concurrency cap of all requests or of an EndpointGroup.
+type limits struct {
+	rate        *rateLimit
+	maxInFlight int
+}
+
+type limiterStage struct {
+	bucket    *limit.Bucket
+	semaphore limit.Semaphore
+}
+
+func newLimiterStage(l limits) *limiterStage {
+	s := &limiterStage{}
+	if l.rate != nil {
+		s.bucket = limit.NewBucket(l.rate.rate, l.rate.burst)
+	}
+	if l.maxInFlight > 0 {
+		s.semaphore = limit.NewSemaphore(l.maxInFlight)
+	}
+	return s
+}
+
+// limiter blocks requests exceeding configured rate limits and concurrency caps.
+type limiter struct {
+	global   *limiterStage
+	groups   map[EndpointGroup]*limiterStage
+	observer WaitObserver
+}
+
+// newLimiter returns nil if no limits are configured.
+func newLimiter(co *clientOptions) *limiter {
+	if co.limits == (limits{}) && len(co.groupLimits) == 0 {
+		return nil
+	}
+	l := &limiter{
+		global:   newLimiterStage(co.limits),
+		groups:   make(map[EndpointGroup]*limiterStage, len(co.groupLimits)),
+		observer: co.waitObserver,
+	}
+	for group, gl := range co.groupLimits {
+		l.groups[group] = newLimiterStage(gl)
+	}
+	return l
+}
+
+// acquire blocks until request to ep is allowed. Call release after request is finished.
+func (l *limiter) acquire(ctx context.Context, ep endpoint) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	var (
+		wait     time.Duration
+		acquired []limit.Semaphore
+	)
+	release = func() {
+		for _, s := range acquired {
+			s.Release()
+		}
+	}
+	stages := []*limiterStage{l.groups[ep.group], l.global}
+	for _, s := range stages {
+		if s == nil || s.semaphore == nil {
+			continue
+		}
+		d, err := s.semaphore.Acquire(ctx)
+		wait += d
+		if err != nil {
+			release()
+			return nil, err
+		}
+		acquired = append(acquired, s.semaphore)
+	}
+	for _, s := range stages {
+		if s == nil || s.bucket == nil {
+			continue
+		}
+		d, err := s.bucket.Wait(ctx)
+		wait += d
+		if err != nil {
+			release()
+			return nil, err
+		}
+	}
+	if wait > 0 && l.observer != nil {
+		l.observer(ep.path, ep.group, wait)
+	}
+	return release, nil
+}
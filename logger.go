@@ -0,0 +1,109 @@
+package maigo
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TikhonP/maigo/internal/net"
+	"github.com/TikhonP/maigo/internal/redact"
+)
+
+// RequestLog describes finished HTTP request to Medsenger API.
+//
+// Bodies have api key, agent tokens and patient personal data redacted.
+type RequestLog struct {
+	Method       string        // HTTP method.
+	Endpoint     string        // Request path, e.g. "/api/agents/message".
+	StatusCode   int           // Response status code, 0 if no response was received.
+	Latency      time.Duration // Time spent on request including reading of the response.
+	Err          error         // Request error, nil on success.
+	RequestBody  []byte        // Redacted request body, set only WithBodyLogging.
+	ResponseBody []byte        // Redacted response body, set only WithBodyLogging.
+}
+
+// Logger receives log of each HTTP request performed by Client, including retries.
+type Logger interface {
+	LogRequest(ctx context.Context, entry RequestLog)
+}
+
+// LoggerFunc is an adapter to use ordinary function as Logger.
+type LoggerFunc func(ctx context.Context, entry RequestLog)
+
+func (f LoggerFunc) LogRequest(ctx context.Context, entry RequestLog) {
+	f(ctx, entry)
+}
+
+// NewStdLogger returns Logger writing one line per request to l.
+func NewStdLogger(l *log.Logger) Logger {
+	return LoggerFunc(func(_ context.Context, e RequestLog) {
+		msg := "maigo: " + e.Method + " " + e.Endpoint + " " + e.Latency.String()
+		if e.StatusCode != 0 {
+			msg += " status=" + strconv.Itoa(e.StatusCode)
+		}
+		if e.Err != nil {
+			msg += " error=" + e.Err.Error()
+		}
+		if e.RequestBody != nil {
+			msg += " request=" + string(e.RequestBody)
+		}
+		if e.ResponseBody != nil {
+			msg += " response=" + string(e.ResponseBody)
+		}
+		l.Println(msg)
+	})
+}
+
+// redactedKeys are JSON keys which values are never logged.
+var redactedKeys = map[string]bool{
+	"api_key":             true,
+	"agent_token":         true,
+	"patient_agent_token": true,
+	"doctor_agent_token":  true,
+	"email":               true,
+	"phone":               true,
+	"birthday":            true,
+	"doctor_name":         true,
+	"doctor_phone":        true,
+}
+
+// personalRedactedKeys are redacted additionally for endpoints returning patient data.
+var personalRedactedKeys = map[string]bool{
+	"name": true,
+	"age":  true,
+}
+
+func (ep endpoint) redactedKeys() map[string]bool {
+	if !ep.personal {
+		return redactedKeys
+	}
+	keys := make(map[string]bool, len(redactedKeys)+len(personalRedactedKeys))
+	for k := range redactedKeys {
+		keys[k] = true
+	}
+	for k := range personalRedactedKeys {
+		keys[k] = true
+	}
+	return keys
+}
+
+// logRequest reports performed request to Client logger.
+func (c *Client) logRequest(ctx context.Context, ep endpoint, x *net.Exchange, latency time.Duration, err error) {
+	entry := RequestLog{
+		Method:     http.MethodPost,
+		Endpoint:   ep.path,
+		StatusCode: x.StatusCode,
+		Latency:    latency,
+	}
+	if err != nil {
+		entry.Err = newAPIError(ep.path, err)
+	}
+	if x.CaptureBodies {
+		keys := ep.redactedKeys()
+		entry.RequestBody = redact.JSON(x.RequestBody, keys)
+		entry.ResponseBody = redact.JSON(x.ResponseBody, keys)
+	}
+	c.logger.LogRequest(ctx, entry)
+}
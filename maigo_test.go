@@ -0,0 +1,86 @@
+package maigo
+
+import (
+	"encoding/json"
+	"errors"
+	stdnet "net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// testServer is fake Medsenger counting requests by path.
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]int
+	bodies   map[string][]json.RawMessage
+	handler  func(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage)
+}
+
+func newTestServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage)) *testServer {
+	s := &testServer{requests: make(map[string]int), bodies: make(map[string][]json.RawMessage), handler: handler}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]json.RawMessage
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		raw, _ := json.Marshal(body)
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		s.bodies[r.URL.Path] = append(s.bodies[r.URL.Path], raw)
+		s.mu.Unlock()
+		s.handler(w, r, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// writeOK answers fake Medsenger requests like Medsenger does.
+func writeOK(w http.ResponseWriter, r *http.Request, _ map[string]json.RawMessage) {
+	switch r.URL.Path {
+	case messageEndpoint.path:
+		_, _ = w.Write([]byte(`{"state":"ok","id":1}`))
+	case addRecordsEndpoint.path:
+		_, _ = w.Write([]byte(`[1]`))
+	case contractInfoEndpoint.path:
+		_, _ = w.Write([]byte(`{"name":"Patient"}`))
+	default:
+		_, _ = w.Write([]byte(`{"state":"ok"}`))
+	}
+}
+
+// switchableTransport fails requests with dial error while down is set.
+type switchableTransport struct {
+	down int32
+}
+
+func (t *switchableTransport) setDown(down bool) {
+	var v int32
+	if down {
+		v = 1
+	}
+	atomic.StoreInt32(&t.down, v)
+}
+
+func (t *switchableTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if atomic.LoadInt32(&t.down) == 1 {
+		return nil, &stdnet.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newTestClient(t *testing.T, server *testServer, opts ...ClientOption) *Client {
+	t.Helper()
+	c, err := NewClient(testAPIKey, append([]ClientOption{WithBaseURL(server.URL)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return c
+}
@@ -0,0 +1,126 @@
+// Package maigotest provides helpers for testing code that uses maigo.
+package maigotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/TikhonP/maigo"
+)
+
+// RecordedSpan is a span finished by Recorder.
+type RecordedSpan struct {
+	maigo.SpanInfo
+	maigo.SpanResult
+	Start    time.Time
+	Duration time.Duration
+}
+
+// RequestCount is a key of request counter.
+type RequestCount struct {
+	Endpoint   string
+	StatusCode int
+	Failed     bool
+}
+
+// Recorder is in-memory maigo.Tracer and maigo.Metrics. It is safe for concurrent use.
+type Recorder struct {
+	mu        sync.Mutex
+	spans     []RecordedSpan
+	counts    map[RequestCount]int
+	latencies map[string][]time.Duration
+}
+
+var (
+	_ maigo.Tracer  = (*Recorder)(nil)
+	_ maigo.Metrics = (*Recorder)(nil)
+)
+
+// NewRecorder creates empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		counts:    make(map[RequestCount]int),
+		latencies: make(map[string][]time.Duration),
+	}
+}
+
+type recorderSpan struct {
+	r     *Recorder
+	info  maigo.SpanInfo
+	start time.Time
+}
+
+func (s *recorderSpan) End(result maigo.SpanResult) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.spans = append(s.r.spans, RecordedSpan{
+		SpanInfo:   s.info,
+		SpanResult: result,
+		Start:      s.start,
+		Duration:   time.Since(s.start),
+	})
+}
+
+func (r *Recorder) StartSpan(ctx context.Context, info maigo.SpanInfo) (context.Context, maigo.Span) {
+	return ctx, &recorderSpan{r: r, info: info, start: time.Now()}
+}
+
+func (r *Recorder) CountRequest(endpoint string, statusCode int, failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[RequestCount{Endpoint: endpoint, StatusCode: statusCode, Failed: failed}]++
+}
+
+func (r *Recorder) ObserveLatency(endpoint string, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies[endpoint] = append(r.latencies[endpoint], latency)
+}
+
+// Spans returns finished spans in order of finishing.
+func (r *Recorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedSpan(nil), r.spans...)
+}
+
+// Counts returns number of requests by endpoint, status code and failure.
+func (r *Recorder) Counts() map[RequestCount]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[RequestCount]int, len(r.counts))
+	for k, v := range r.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// Requests returns number of requests to endpoint.
+func (r *Recorder) Requests(endpoint string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for k, v := range r.counts {
+		if k.Endpoint == endpoint {
+			n += v
+		}
+	}
+	return n
+}
+
+// Latencies returns observed latencies of requests to endpoint.
+func (r *Recorder) Latencies(endpoint string) []time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]time.Duration(nil), r.latencies[endpoint]...)
+}
+
+// Reset removes all recorded data.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+	r.counts = make(map[RequestCount]int)
+	r.latencies = make(map[string][]time.Duration)
+}
@@ -0,0 +1,404 @@
+package maigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TikhonP/maigo/internal/api"
+	"github.com/TikhonP/maigo/internal/net"
+)
+
+// ErrQueued is matched by *QueuedError with errors.Is.
+var ErrQueued = errors.New("maigo: request is queued in outbox")
+
+// QueuedError is returned by write methods when request was persisted in the outbox
+// instead of being delivered. Outbox delivers it later, so the call must not be repeated.
+type QueuedError struct {
+	EntryId string // Identifier of the outbox entry.
+	Err     error  // Error of the delivery attempt, nil if request was queued after earlier requests of the contract.
+}
+
+func (e *QueuedError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("maigo: request is queued in outbox as %s", e.EntryId)
+	}
+	return fmt.Sprintf("maigo: request is queued in outbox as %s: %v", e.EntryId, e.Err)
+}
+
+func (e *QueuedError) Is(target error) bool {
+	return target == ErrQueued
+}
+
+func (e *QueuedError) Unwrap() error {
+	return e.Err
+}
+
+// OutboxEntry is a write request persisted while Medsenger was unavailable.
+type OutboxEntry struct {
+	Id         string          `json:"id"`
+	ContractId int             `json:"contract_id"`
+	Endpoint   string          `json:"endpoint"`             // Request path, e.g. "/api/agents/message".
+	Payload    json.RawMessage `json:"payload"`              // Request body without api key.
+	CreatedAt  time.Time       `json:"created_at"`           // Time of the first delivery attempt.
+	Attempts   int             `json:"attempts"`             // Failed replays.
+	LastError  string          `json:"last_error,omitempty"` // Error of the last replay.
+	DeadLetter bool            `json:"dead_letter"`          // Entry is not replayed anymore.
+
+	// IdempotencyKey is the idempotency store key of the call, its ids are saved under it after delivery.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// OutboxConfig configures Outbox.
+type OutboxConfig struct {
+	MaxAttempts  int           // Replays before entry is dead-lettered, 10 if not set.
+	PollInterval time.Duration // Interval between replays in Run, 30s if not set.
+
+	// OnDelivered is called after entry was replayed with Medsenger response.
+	OnDelivered func(entry OutboxEntry, response json.RawMessage)
+	// OnDeadLetter is called after entry was dead-lettered.
+	OnDeadLetter func(entry OutboxEntry)
+	// OnError is called by Run when replay fails because of the store error.
+	OnError func(err error)
+}
+
+// Outbox persists SendMessage, AddRecord, AddRecords and SendRecordAddition requests
+// that failed because Medsenger was unavailable and replays them in per-contract order.
+// SendMessage, AddRecord and AddRecords are queued only if they did not reach Medsenger,
+// e.g. on connection error or 429; after 5xx or timeout they may have been processed and fail instead.
+//
+// While contract has queued entries, its new write requests are queued too, so they
+// are never delivered before earlier ones.
+type Outbox struct {
+	client *Client
+	store  OutboxStore
+	config OutboxConfig
+
+	flushMu sync.Mutex // Serializes replays.
+	mu      sync.Mutex
+	pending map[int]int // Number of queued entries by contract.
+	seq     uint64
+}
+
+func newOutbox(c *Client, store OutboxStore, config OutboxConfig) (*Outbox, error) {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 30 * time.Second
+	}
+	o := &Outbox{client: c, store: store, config: config, pending: make(map[int]int)}
+	entries, err := store.List(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.DeadLetter {
+			o.pending[e.ContractId]++
+		}
+	}
+	return o, nil
+}
+
+// outboxEndpoints are endpoints which requests can be queued in the outbox.
+var outboxEndpoints = map[string]endpoint{
+	messageEndpoint.path:        messageEndpoint,
+	addRecordsEndpoint.path:     addRecordsEndpoint,
+	recordAdditionEndpoint.path: recordAdditionEndpoint,
+}
+
+// Outbox returns Client outbox or nil if it is not configured.
+func (c *Client) Outbox() *Outbox {
+	return c.outbox
+}
+
+func (o *Outbox) hasPending(contractId int) bool {
+	if o == nil {
+		return false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pending[contractId] > 0
+}
+
+func (o *Outbox) addPending(contractId int, delta int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending[contractId] += delta
+	if o.pending[contractId] <= 0 {
+		delete(o.pending, contractId)
+	}
+}
+
+// accepts reports whether request to ep failed with err can be queued. Requests to not idempotent
+// endpoints are queued only if they certainly did not reach Medsenger, so they are never delivered twice.
+func (o *Outbox) accepts(ep endpoint, err error) bool {
+	return o != nil && (net.Retryable(err, ep.idempotent) || errors.Is(err, ErrCircuitOpen))
+}
+
+// enqueue persists request to ep. It returns *QueuedError with cause or error of the store.
+func (o *Outbox) enqueue(ctx context.Context, ep endpoint, request any, cause error) error {
+	payload, err := outboxPayload(request)
+	if err != nil {
+		return err
+	}
+	entry := OutboxEntry{
+		Id:         strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(atomic.AddUint64(&o.seq, 1), 36),
+		ContractId: api.ContractOf(request),
+		Endpoint:   ep.path,
+		Payload:    payload,
+		CreatedAt:  time.Now(),
+	}
+	entry.IdempotencyKey, _ = ctx.Value(idempotencyStoreKeyContextKey{}).(string)
+	if err := o.store.Add(ctx, entry); err != nil {
+		if cause != nil {
+			return fmt.Errorf("maigo: outbox: %v, request error: %w", err, cause)
+		}
+		return fmt.Errorf("maigo: outbox: %w", err)
+	}
+	o.addPending(entry.ContractId, 1)
+	return &QueuedError{EntryId: entry.Id, Err: cause}
+}
+
+// outboxPayload encodes request without api key.
+func outboxPayload(request any) (json.RawMessage, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "api_key")
+	return json.Marshal(fields)
+}
+
+// outboxRequest is a replayed request body.
+type outboxRequest struct {
+	contractId int
+	fields     map[string]json.RawMessage
+}
+
+func (r outboxRequest) Contract() int {
+	return r.contractId
+}
+
+func (r *outboxRequest) SetApiKey(apiKey string) {
+	r.fields["api_key"], _ = json.Marshal(apiKey)
+}
+
+func (r outboxRequest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.fields)
+}
+
+// replay sends entry with current api key and returns Medsenger response.
+func (o *Outbox) replay(ctx context.Context, entry OutboxEntry) (json.RawMessage, error) {
+	ep, ok := outboxEndpoints[entry.Endpoint]
+	if !ok {
+		return nil, fmt.Errorf("maigo: outbox: unsupported endpoint %s", entry.Endpoint)
+	}
+	request := outboxRequest{contractId: entry.ContractId}
+	if err := json.Unmarshal(entry.Payload, &request.fields); err != nil {
+		return nil, err
+	}
+	var response json.RawMessage
+	err := makeStreamRequest(ctx, o.client, ep, request, func(decoder *json.Decoder) error {
+		if err := decoder.Decode(&response); err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	})
+	return response, err
+}
+
+// Flush replays queued entries once. Entries of a contract are replayed in order;
+// replay of the contract stops at the first entry that still cannot be delivered.
+// Entries rejected by Medsenger or failed MaxAttempts times are dead-lettered.
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.flushMu.Lock()
+	defer o.flushMu.Unlock()
+	entries, err := o.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	blocked := make(map[int]bool)
+	for _, entry := range entries {
+		if entry.DeadLetter || blocked[entry.ContractId] {
+			continue
+		}
+		response, err := o.replay(ctx, entry)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			if err := o.store.Remove(ctx, entry.Id); err != nil {
+				return err
+			}
+			o.addPending(entry.ContractId, -1)
+			o.client.saveDelivered(ctx, entry, response)
+			if o.config.OnDelivered != nil {
+				o.config.OnDelivered(entry, response)
+			}
+			continue
+		}
+		entry.Attempts++
+		entry.LastError = err.Error()
+		if entry.Attempts >= o.config.MaxAttempts || !o.accepts(outboxEndpoints[entry.Endpoint], err) {
+			entry.DeadLetter = true
+		} else {
+			blocked[entry.ContractId] = true
+		}
+		if err := o.store.Update(ctx, entry); err != nil {
+			return err
+		}
+		if entry.DeadLetter {
+			o.addPending(entry.ContractId, -1)
+			if o.config.OnDeadLetter != nil {
+				o.config.OnDeadLetter(entry)
+			}
+		}
+	}
+	return nil
+}
+
+// Run replays queued entries every PollInterval until ctx is done.
+func (o *Outbox) Run(ctx context.Context) error {
+	ticker := time.NewTicker(o.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := o.Flush(ctx); err != nil && ctx.Err() == nil && o.config.OnError != nil {
+			o.config.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Entries returns queued entries in order of delivery.
+func (o *Outbox) Entries(ctx context.Context) ([]OutboxEntry, error) {
+	return o.list(ctx, false)
+}
+
+// DeadLetters returns entries that are not replayed anymore.
+func (o *Outbox) DeadLetters(ctx context.Context) ([]OutboxEntry, error) {
+	return o.list(ctx, true)
+}
+
+func (o *Outbox) list(ctx context.Context, deadLetter bool) ([]OutboxEntry, error) {
+	entries, err := o.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filtered := entries[:0]
+	for _, e := range entries {
+		if e.DeadLetter == deadLetter {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered, nil
+}
+
+// entryWithIdempotencyKey returns queued or dead-lettered entry of the call with idempotency store key.
+func (o *Outbox) entryWithIdempotencyKey(ctx context.Context, key string) (OutboxEntry, bool, error) {
+	if o == nil {
+		return OutboxEntry{}, false, nil
+	}
+	entries, err := o.store.List(ctx)
+	if err != nil {
+		return OutboxEntry{}, false, err
+	}
+	for _, e := range entries {
+		if e.IdempotencyKey == key {
+			return e, true, nil
+		}
+	}
+	return OutboxEntry{}, false, nil
+}
+
+// Requeue returns dead-lettered entry to the queue with reset attempts.
+func (o *Outbox) Requeue(ctx context.Context, id string) error {
+	o.flushMu.Lock()
+	defer o.flushMu.Unlock()
+	entries, err := o.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	i := indexOfOutboxEntry(entries, id)
+	if i < 0 {
+		return ErrOutboxEntryNotFound
+	}
+	entry := entries[i]
+	if !entry.DeadLetter {
+		return nil
+	}
+	entry.DeadLetter = false
+	entry.Attempts = 0
+	if err := o.store.Update(ctx, entry); err != nil {
+		return err
+	}
+	o.addPending(entry.ContractId, 1)
+	return nil
+}
+
+// Remove deletes entry from the outbox without delivering it.
+func (o *Outbox) Remove(ctx context.Context, id string) error {
+	o.flushMu.Lock()
+	defer o.flushMu.Unlock()
+	entries, err := o.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	i := indexOfOutboxEntry(entries, id)
+	if i < 0 {
+		return ErrOutboxEntryNotFound
+	}
+	if err := o.store.Remove(ctx, id); err != nil {
+		return err
+	}
+	if !entries[i].DeadLetter {
+		o.addPending(entries[i].ContractId, -1)
+	}
+	return nil
+}
+
+// writeRequest is like makeRequest but queues request in the Client outbox
+// if Medsenger is unavailable. Dry-run requests are never queued.
+func writeRequest[Request any, Response any](ctx context.Context, c *Client, ep endpoint, request Request) (*Response, error) {
+	if c.dryRun != nil {
+		return makeRequest[Request, Response](ctx, c, ep, request)
+	}
+	if c.outbox.hasPending(api.ContractOf(request)) {
+		return nil, c.outbox.enqueue(ctx, ep, request, nil)
+	}
+	resp, err := makeRequest[Request, Response](ctx, c, ep, request)
+	if err != nil && c.outbox.accepts(ep, err) {
+		return nil, c.outbox.enqueue(ctx, ep, request, err)
+	}
+	return resp, err
+}
+
+// writeRequestWithEmptyResponse is like makeRequestWithEmptyResponse but queues request
+// in the Client outbox if Medsenger is unavailable. Dry-run requests are never queued.
+func writeRequestWithEmptyResponse[Request any](ctx context.Context, c *Client, ep endpoint, request Request) error {
+	if c.dryRun != nil {
+		return makeRequestWithEmptyResponse(ctx, c, ep, request)
+	}
+	if c.outbox.hasPending(api.ContractOf(request)) {
+		return c.outbox.enqueue(ctx, ep, request, nil)
+	}
+	err := makeRequestWithEmptyResponse(ctx, c, ep, request)
+	if err != nil && c.outbox.accepts(ep, err) {
+		return c.outbox.enqueue(ctx, ep, request, err)
+	}
+	return err
+}
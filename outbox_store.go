@@ -0,0 +1,170 @@
+package maigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrOutboxEntryNotFound is returned by OutboxStore when entry does not exist.
+var ErrOutboxEntryNotFound = errors.New("maigo: outbox entry not found")
+
+// OutboxStore persists outbox entries. Implementations must be safe for concurrent use.
+type OutboxStore interface {
+	// Add appends entry to the end of the store.
+	Add(ctx context.Context, entry OutboxEntry) error
+	// Update replaces entry with the same Id keeping its position.
+	Update(ctx context.Context, entry OutboxEntry) error
+	// Remove deletes entry by id.
+	Remove(ctx context.Context, id string) error
+	// List returns all entries in order they were added.
+	List(ctx context.Context) ([]OutboxEntry, error)
+}
+
+// MemoryOutboxStore keeps outbox entries in memory. Entries are lost when process exits.
+type MemoryOutboxStore struct {
+	mu      sync.Mutex
+	entries []OutboxEntry
+}
+
+// NewMemoryOutboxStore creates empty MemoryOutboxStore.
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{}
+}
+
+func (s *MemoryOutboxStore) Add(_ context.Context, entry OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *MemoryOutboxStore) Update(_ context.Context, entry OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := indexOfOutboxEntry(s.entries, entry.Id)
+	if i < 0 {
+		return ErrOutboxEntryNotFound
+	}
+	s.entries[i] = entry
+	return nil
+}
+
+func (s *MemoryOutboxStore) Remove(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := indexOfOutboxEntry(s.entries, id)
+	if i < 0 {
+		return ErrOutboxEntryNotFound
+	}
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	return nil
+}
+
+func (s *MemoryOutboxStore) List(_ context.Context) ([]OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]OutboxEntry(nil), s.entries...), nil
+}
+
+// FileOutboxStore keeps outbox entries in JSON file. File is rewritten atomically on each change.
+type FileOutboxStore struct {
+	path string
+	mu   sync.Mutex // Serializes changes.
+	mem  MemoryOutboxStore
+}
+
+// NewFileOutboxStore opens FileOutboxStore at path, loading existing entries.
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	s := &FileOutboxStore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.mem.entries); err != nil {
+		return nil, fmt.Errorf("maigo: outbox file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *FileOutboxStore) Add(ctx context.Context, entry OutboxEntry) error {
+	return s.change(func() error { return s.mem.Add(ctx, entry) })
+}
+
+func (s *FileOutboxStore) Update(ctx context.Context, entry OutboxEntry) error {
+	return s.change(func() error { return s.mem.Update(ctx, entry) })
+}
+
+func (s *FileOutboxStore) Remove(ctx context.Context, id string) error {
+	return s.change(func() error { return s.mem.Remove(ctx, id) })
+}
+
+func (s *FileOutboxStore) List(ctx context.Context) ([]OutboxEntry, error) {
+	return s.mem.List(ctx)
+}
+
+// change applies f to entries in memory and writes them to file.
+// Entries in memory are restored if writing fails.
+func (s *FileOutboxStore) change(f func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mem.mu.Lock()
+	backup := append([]OutboxEntry(nil), s.mem.entries...)
+	s.mem.mu.Unlock()
+	if err := f(); err != nil {
+		return err
+	}
+	s.mem.mu.Lock()
+	defer s.mem.mu.Unlock()
+	if err := s.write(); err != nil {
+		s.mem.entries = backup
+		return err
+	}
+	return nil
+}
+
+// write must be called with s.mem.mu held.
+func (s *FileOutboxStore) write() error {
+	data, err := json.Marshal(s.mem.entries)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic replaces file at path with data, so readers never see partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func indexOfOutboxEntry(entries []OutboxEntry, id string) int {
+	for i, e := range entries {
+		if e.Id == id {
+			return i
+		}
+	}
+	return -1
+}
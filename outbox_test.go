@@ -0,0 +1,72 @@
+package maigo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestOutboxQueuesAndReplaysUndeliveredWrites(t *testing.T) {
+	server := newTestServer(t, writeOK)
+	transport := &switchableTransport{}
+	c := newTestClient(t, server, WithTransport(transport), WithOutbox(NewMemoryOutboxStore(), OutboxConfig{}))
+	ctx := context.Background()
+
+	transport.setDown(true)
+	if _, err := c.SendMessage(1, "first"); !errors.Is(err, ErrQueued) {
+		t.Fatalf("SendMessage() error = %v, want ErrQueued", err)
+	}
+	transport.setDown(false)
+	// Contract has pending entry, so the next message is queued behind it.
+	if _, err := c.SendMessage(1, "second"); !errors.Is(err, ErrQueued) {
+		t.Fatalf("SendMessage() error = %v, want ErrQueued", err)
+	}
+	if n := server.count(messageEndpoint.path); n != 0 {
+		t.Fatalf("server got %d messages before flush, want 0", n)
+	}
+	if err := c.Outbox().Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if n := server.count(messageEndpoint.path); n != 2 {
+		t.Fatalf("server got %d messages, want 2", n)
+	}
+	var texts []string
+	for _, body := range server.bodies[messageEndpoint.path] {
+		var request struct {
+			ApiKey  string `json:"api_key"`
+			Message struct {
+				Text string `json:"text"`
+			} `json:"message"`
+		}
+		_ = json.Unmarshal(body, &request)
+		if request.ApiKey != testAPIKey {
+			t.Errorf("replayed api_key = %q", request.ApiKey)
+		}
+		texts = append(texts, request.Message.Text)
+	}
+	if len(texts) != 2 || texts[0] != "first" || texts[1] != "second" {
+		t.Fatalf("replayed texts = %v, want [first second]", texts)
+	}
+	if entries, _ := c.Outbox().Entries(ctx); len(entries) != 0 {
+		t.Fatalf("outbox has %d entries after flush", len(entries))
+	}
+}
+
+func TestOutboxDoesNotQueueMessageThatMayBeDelivered(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request, body map[string]json.RawMessage) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+	})
+	c := newTestClient(t, server, WithOutbox(NewMemoryOutboxStore(), OutboxConfig{}))
+	_, err := c.SendMessage(1, "hello")
+	if err == nil || errors.Is(err, ErrQueued) {
+		t.Fatalf("SendMessage() error = %v, want not queued error", err)
+	}
+	if err := c.Outbox().Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if n := server.count(messageEndpoint.path); n != 1 {
+		t.Fatalf("server got %d messages, want 1", n)
+	}
+}
@@ -0,0 +1,143 @@
+package maigo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/TikhonP/maigo/internal/api"
+	"github.com/TikhonP/maigo/internal/net"
+)
+
+// do performs attempt of request to ep applying Client circuit breakers, limits, failover and retry policy.
+// Errors reported by Medsenger are returned as *APIError.
+func (c *Client) do(ctx context.Context, ep endpoint, contractId int, attempt func(ctx context.Context, cfg net.Config) error) error {
+	ctx, span := c.startSpan(ctx, ep, contractId)
+	cfg := net.Config{Client: c.httpClient, MaxResponseSize: c.maxResponseSize}
+	var attempts, statusCode int
+	err := net.Retry(ctx, c.retryPolicy, ep.idempotent, func(ctx context.Context) (err error) {
+		attempts++
+		statusCode = 0
+		done, err := c.allowRequest(ep)
+		if err != nil {
+			return err
+		}
+		release, err := c.limiter.acquire(ctx, ep)
+		if err != nil {
+			done(err)
+			return err
+		}
+		defer release()
+		statusCode, err = c.attemptHosts(ctx, ep, cfg, attempt)
+		done(err)
+		return err
+	})
+	if err != nil {
+		err = newAPIError(ep.path, err)
+		var apiErr *APIError
+		if c.onUnauthorized != nil && errors.As(err, &apiErr) && errors.Is(apiErr, ErrUnauthorized) {
+			c.onUnauthorized(ctx, apiErr)
+		}
+	}
+	span.End(SpanResult{StatusCode: statusCode, Attempts: attempts, Err: err})
+	return err
+}
+
+// observeAttempt performs attempt and reports it to Client logger and metrics.
+// It returns response status code.
+func (c *Client) observeAttempt(ctx context.Context, ep endpoint, cfg net.Config, attempt func(ctx context.Context, cfg net.Config) error) (int, error) {
+	cfg.Exchange = &net.Exchange{CaptureBodies: c.logger != nil && c.logBodies}
+	start := time.Now()
+	err := attempt(ctx, cfg)
+	latency := time.Since(start)
+	if c.metrics != nil {
+		c.metrics.CountRequest(ep.path, cfg.Exchange.StatusCode, err != nil)
+		c.metrics.ObserveLatency(ep.path, latency)
+	}
+	if c.logger != nil {
+		c.logRequest(ctx, ep, cfg.Exchange, latency, err)
+	}
+	return cfg.Exchange.StatusCode, err
+}
+
+// makeRequest posts request to endpoint and decodes response.
+func makeRequest[Request any, Response any](ctx context.Context, c *Client, ep endpoint, request Request) (*Response, error) {
+	var resp *Response
+	if synthetic, intercepted, err := c.dryRun.intercept(ctx, ep, request); intercepted {
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(synthetic, &resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	err := c.do(ctx, ep, api.ContractOf(request), func(ctx context.Context, cfg net.Config) (err error) {
+		if err := c.setApiKey(ctx, &request); err != nil {
+			return err
+		}
+		resp, err = net.MakeRequest[Request, Response](ctx, cfg, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, &APIError{Endpoint: ep.path, StatusCode: http.StatusOK, Message: "null response", kind: ErrEmptyResponse}
+	}
+	return resp, nil
+}
+
+// makeRequestWithEmptyResponse posts request to endpoint and ignores response.
+func makeRequestWithEmptyResponse[Request any](ctx context.Context, c *Client, ep endpoint, request Request) error {
+	if _, intercepted, err := c.dryRun.intercept(ctx, ep, request); intercepted {
+		return err
+	}
+	return c.do(ctx, ep, api.ContractOf(request), func(ctx context.Context, cfg net.Config) error {
+		if err := c.setApiKey(ctx, &request); err != nil {
+			return err
+		}
+		return net.MakeRequestWithEmptyResponse(ctx, cfg, request)
+	})
+}
+
+// makeStreamRequest posts request to endpoint and passes decoder of the response to decode.
+func makeStreamRequest[Request any](ctx context.Context, c *Client, ep endpoint, request Request, decode func(decoder *json.Decoder) error) error {
+	if synthetic, intercepted, err := c.dryRun.intercept(ctx, ep, request); intercepted {
+		if err != nil {
+			return err
+		}
+		return decode(json.NewDecoder(bytes.NewReader(synthetic)))
+	}
+	return c.do(ctx, ep, api.ContractOf(request), func(ctx context.Context, cfg net.Config) error {
+		if err := c.setApiKey(ctx, &request); err != nil {
+			return err
+		}
+		return net.MakeStreamRequest(ctx, cfg, request, decode)
+	})
+}
+
+// decodeArray calls decodeItem for each element of JSON array. JSON null is treated as empty array.
+func decodeArray(decoder *json.Decoder, decodeItem func(decoder *json.Decoder) error) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected JSON array, got %v", token)
+	}
+	for decoder.More() {
+		if err := decodeItem(decoder); err != nil {
+			return err
+		}
+	}
+	_, err = decoder.Token()
+	return err
+}
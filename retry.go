@@ -0,0 +1,38 @@
+package maigo
+
+import (
+	"time"
+
+	"github.com/TikhonP/maigo/internal/net"
+)
+
+// RetryPolicy configures retries of failed requests with exponential backoff,
+// jitter and Retry-After support.
+//
+// Reading endpoints such as GetRecords or GetCategories are retried on network errors,
+// throttling and 5xx responses. Writing endpoints such as SendMessage or AddRecord are
+// retried only when Medsenger certainly did not receive the request (connection was
+// not established or request was throttled), so retries never duplicate messages or records.
+type RetryPolicy = net.RetryPolicy
+
+// RetryBudget limits retries to a fraction of all requests of the Client.
+type RetryBudget = net.RetryBudget
+
+// NewRetryBudget creates RetryBudget allowing ratio retries per request
+// with at most burst retries accumulated.
+func NewRetryBudget(ratio float64, burst int) *RetryBudget {
+	return net.NewRetryBudget(ratio, burst)
+}
+
+// DefaultRetryPolicy returns RetryPolicy with three attempts and backoff from 200ms to 5s.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		MaxRetryAfter:  30 * time.Second,
+		Budget:         NewRetryBudget(0.2, 10),
+	}
+}
@@ -21,6 +21,8 @@ type sendMessageOptions struct {
 	ActionDeadline  *json.Timestamp     `json:"action_deadline,omitempty"`
 	IsUrgent        bool                `json:"is_urgent"`
 	Attachments     []MessageAttachment `json:"attachments,omitempty"`
+
+	signedAction *signedAction // Signs ActionLink before sending if not nil.
 }
 
 func newSendMessageOptions(text string, opts ...SendMessageOption) *sendMessageOptions {
@@ -87,6 +89,19 @@ func WithAction(name string, link string, actionType MessageActionType) SendMess
 		o.ActionName = name
 		o.ActionLink = link
 		o.ActionType = actionType
+		o.signedAction = nil
+	})
+}
+
+// WithSignedAction is like WithAction, but link is signed by signer for contract and role
+// of the user who is expected to open it. Link expires at WithActionDeadline or after signer ttl.
+// Verify it with ActionSigner.Verify or agent.RequireSignedAction.
+func WithSignedAction(signer *ActionSigner, role UserRole, name string, link string, actionType MessageActionType) SendMessageOption {
+	return newFuncSendMessageOption(func(o *sendMessageOptions) {
+		o.ActionName = name
+		o.ActionLink = link
+		o.ActionType = actionType
+		o.signedAction = &signedAction{signer: signer, role: role}
 	})
 }
 
@@ -161,4 +176,3 @@ func WithAttachments(a []MessageAttachment) SendMessageOption {
 		o.Attachments = a
 	})
 }
-
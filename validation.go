@@ -0,0 +1,105 @@
+package maigo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ValidationError describes request rejected by Client before sending.
+// It matches ErrValidation with errors.Is.
+type ValidationError struct {
+	Field  string // Invalid argument, e.g. "contractId".
+	Reason string // Human readable description of the problem.
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("maigo: invalid %s: %s", e.Field, e.Reason)
+}
+
+// Is reports whether target is ErrValidation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+func validateContractId(contractId int) error {
+	if contractId <= 0 {
+		return &ValidationError{Field: "contractId", Reason: "must be positive"}
+	}
+	return nil
+}
+
+func validateMessage(contractId int, message *sendMessageOptions) error {
+	if err := validateContractId(contractId); err != nil {
+		return err
+	}
+	if strings.TrimSpace(message.Text) == "" && len(message.Attachments) == 0 {
+		return &ValidationError{Field: "text", Reason: "must not be empty"}
+	}
+	if message.ActionLink != "" && message.ActionName == "" {
+		return &ValidationError{Field: "action", Reason: "name must be set with link"}
+	}
+	if message.OnlyDoctor && message.OnlyPatient {
+		return &ValidationError{Field: "options", Reason: "OnlyDoctor and OnlyPatient are mutually exclusive"}
+	}
+	return nil
+}
+
+func validateRecord(r Record) *ValidationError {
+	if strings.TrimSpace(r.CategoryName) == "" {
+		return &ValidationError{Field: "categoryName", Reason: "must not be empty"}
+	}
+	if r.Time.IsZero() {
+		return &ValidationError{Field: "time", Reason: "must be set"}
+	}
+	if len(r.Params) > 0 {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(r.Params, &fields); err != nil {
+			return &ValidationError{Field: "params", Reason: "must be JSON object"}
+		}
+	}
+	return nil
+}
+
+func validateRecords(contractId int, records []Record) error {
+	if err := validateContractId(contractId); err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return &ValidationError{Field: "records", Reason: "must not be empty"}
+	}
+	for i, r := range records {
+		if err := validateRecord(r); err != nil {
+			return &ValidationError{Field: fmt.Sprintf("records[%d].%s", i, err.Field), Reason: err.Reason}
+		}
+	}
+	return nil
+}
+
+func validateCategoryNames(contractId int, categoryNames []string) error {
+	if err := validateContractId(contractId); err != nil {
+		return err
+	}
+	if len(categoryNames) == 0 {
+		return &ValidationError{Field: "categoryNames", Reason: "must not be empty"}
+	}
+	for i, name := range categoryNames {
+		if strings.TrimSpace(name) == "" {
+			return &ValidationError{Field: fmt.Sprintf("categoryNames[%d]", i), Reason: "must not be empty"}
+		}
+	}
+	return nil
+}
+
+func validateOrder(contractId int, order string, receiverAgentId int) error {
+	if err := validateContractId(contractId); err != nil {
+		return err
+	}
+	if strings.TrimSpace(order) == "" {
+		return &ValidationError{Field: "order", Reason: "must not be empty"}
+	}
+	if receiverAgentId < 0 {
+		return &ValidationError{Field: "receiverAgentId", Reason: "must not be negative"}
+	}
+	return nil
+}